@@ -0,0 +1,198 @@
+package awslambda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// httpInputEnv holds the Input, as JSON, used for HTTP requests. Callers can
+// only choose keys and minify; everything else, such as the GitHub URL or
+// proxy, stays under the operator's control.
+const httpInputEnv = "IPFILTER_HTTP_INPUT"
+
+// httpRequest recognises an API Gateway HTTP API (payload 2.0) or Lambda
+// Function URL event; both use the same format.
+func httpRequest(payload []byte) (*events.APIGatewayV2HTTPRequest, bool) {
+	var req events.APIGatewayV2HTTPRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, false
+	}
+	if req.Version != "2.0" || req.RequestContext.HTTP.Method == "" {
+		return nil, false
+	}
+	return &req, true
+}
+
+// handleHTTP serves the read-only routes:
+//
+//	GET /policy[?keys=actions,web&minify=true]
+//	GET /cidrs[?keys=...&format=json|text]
+//	GET /check?ip=203.0.113.7[&keys=...&format=json|text]
+//
+// HTTP requests never apply anything and do not touch the warm Lambda's
+// last policy.
+func handleHTTP(ctx context.Context, req *events.APIGatewayV2HTTPRequest) (json.RawMessage, error) {
+	return json.Marshal(serveHTTP(ctx, req))
+}
+
+func serveHTTP(ctx context.Context, req *events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	method := req.RequestContext.HTTP.Method
+	route := routePath(req)
+	switch route {
+	case "/policy", "/cidrs", "/check":
+	default:
+		return httpError(http.StatusNotFound, "no route for %s", req.RawPath)
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		resp := httpError(http.StatusMethodNotAllowed, "method %s not allowed", method)
+		resp.Headers["Allow"] = "GET, HEAD"
+		return resp
+	}
+
+	query := req.QueryStringParameters
+	format := query["format"]
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && (format != "text" || route == "/policy") {
+		return httpError(http.StatusBadRequest, "unsupported format %q", format)
+	}
+
+	in, err := httpInput(ctx, query)
+	if err != nil {
+		return httpError(http.StatusBadRequest, "%v", err)
+	}
+	var ip netip.Addr
+	if route == "/check" {
+		if ip, err = netip.ParseAddr(query["ip"]); err != nil {
+			return httpError(http.StatusBadRequest, "query parameter ip must be an IP address")
+		}
+	}
+
+	result, err := generate(ctx, in, nil)
+	var missing *ipfilter.MissingKeyError
+	switch {
+	case errors.As(err, &missing):
+		return httpError(http.StatusBadRequest, "%v", err)
+	case err != nil:
+		log.Printf("Error generating policy: %v", err)
+		return httpError(http.StatusBadGateway, "could not generate the policy")
+	}
+
+	var resp events.APIGatewayV2HTTPResponse
+	switch route {
+	case "/policy":
+		resp = httpBody(http.StatusOK, "application/json", string(result.Policy))
+		etag := `"` + ipfilter.PolicySHA256(result.Policy) + `"`
+		resp.Headers["ETag"] = etag
+		if header(req, "If-None-Match") == etag {
+			resp = httpBody(http.StatusNotModified, "", "")
+			resp.Headers["ETag"] = etag
+		}
+	case "/cidrs":
+		if format == "text" {
+			resp = httpBody(http.StatusOK, "text/plain; charset=utf-8", strings.Join(result.CIDRs, "\n")+"\n")
+		} else {
+			resp = httpJSON(http.StatusOK, result.CIDRs)
+		}
+	case "/check":
+		check, err := ipfilter.ExplainIP(result.Policy, ip, result.Provenance, result.Keys)
+		if err != nil {
+			log.Printf("Error checking %s: %v", ip, err)
+			return httpError(http.StatusInternalServerError, "could not check the address")
+		}
+		if format == "text" {
+			verdict := "denied"
+			if check.Allowed {
+				verdict = "allowed"
+			}
+			resp = httpBody(http.StatusOK, "text/plain; charset=utf-8", check.IP+" "+verdict+": "+check.Reason+"\n")
+		} else {
+			resp = httpJSON(http.StatusOK, check)
+		}
+	}
+	if method == http.MethodHead {
+		resp.Body = ""
+	}
+	return resp
+}
+
+// routePath strips the stage name API Gateway prefixes to rawPath for
+// non-default stages.
+func routePath(req *events.APIGatewayV2HTTPRequest) string {
+	path := req.RawPath
+	if stage := req.RequestContext.Stage; stage != "" && stage != "$default" {
+		path = strings.TrimPrefix(path, "/"+stage)
+	}
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// httpInput builds the Input for a request from newInput, httpInputEnv and
+// the keys and minify query parameters.
+func httpInput(ctx context.Context, query map[string]string) (Input, error) {
+	in, err := newInput(ctx)
+	if err != nil {
+		return in, err
+	}
+	if env := os.Getenv(httpInputEnv); env != "" {
+		if err := json.Unmarshal([]byte(env), &in); err != nil {
+			return in, fmt.Errorf("parsing %s: %w", httpInputEnv, err)
+		}
+	}
+	in.Apply, in.PreviousPolicy = nil, nil
+	if keys := query["keys"]; keys != "" {
+		in.Keys = pipeline.SplitList(keys)
+	}
+	if minify := query["minify"]; minify != "" {
+		b, err := strconv.ParseBool(minify)
+		if err != nil {
+			return in, fmt.Errorf("query parameter minify must be true or false")
+		}
+		in.Minify = b
+	}
+	return in, nil
+}
+
+// header looks up a request header; API Gateway lower-cases their names.
+func header(req *events.APIGatewayV2HTTPRequest, name string) string {
+	if v, ok := req.Headers[strings.ToLower(name)]; ok {
+		return v
+	}
+	return req.Headers[name]
+}
+
+func httpBody(status int, contentType, body string) events.APIGatewayV2HTTPResponse {
+	headers := map[string]string{"Cache-Control": "no-cache"}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Headers: headers, Body: body}
+}
+
+func httpJSON(status int, v any) events.APIGatewayV2HTTPResponse {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return httpError(http.StatusInternalServerError, "%v", err)
+	}
+	return httpBody(status, "application/json", string(b))
+}
+
+func httpError(status int, format string, args ...any) events.APIGatewayV2HTTPResponse {
+	b, _ := json.Marshal(map[string]string{"error": fmt.Sprintf(format, args...)})
+	return httpBody(status, "application/json", string(b))
+}
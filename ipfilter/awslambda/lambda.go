@@ -0,0 +1,280 @@
+// Package awslambda is the Lambda handler. It serves direct invocations,
+// EventBridge schedules and HTTP requests, and is started either by the
+// Lambda-only command or by the CLI when it runs inside Lambda.
+package awslambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// HOW to build this Lambda (the CLI binary detects the Lambda runtime):
+// GOOS=linux GOARCH=amd64 go build -o bootstrap ./ipfilter/cmd/ipfilter
+// zip function.zip bootstrap
+
+/*
+aws iam create-role \
+  --role-name ipfilter-lambda-exec \
+  --assume-role-policy-document '{
+    "Version": "2012-10-17",
+    "Statement": [
+      {
+        "Effect": "Allow",
+        "Principal": { "Service": "lambda.amazonaws.com" },
+        "Action": "sts:AssumeRole"
+      }
+    ]
+  }'
+*/
+
+// Add the loggin role
+/*
+aws iam attach-role-policy \
+  --role-name ipfilter-lambda-exec \
+  --policy-arn arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole
+*/
+
+// Create the Lambda function
+// Modern Go binaries run on AWS’s new “provided” runtime on AL2023.
+// Go Lambda binaries must be named bootstrap
+/*
+aws lambda create-function \
+  --function-name ipfilter-lambda \
+  --handler bootstrap \
+  --runtime provided.al2023 \
+  --role arn:aws:iam::123456789012:role/ipfilter-lambda-exec \
+  --zip-file fileb://function.zip \
+  --architecture x86_64
+*/
+
+// GET the Lambda function
+/*
+aws lambda get-function --function-name ipfilter-lambda
+*/
+
+// UPDATE the Lambda function
+/*
+aws lambda update-function-code \
+  --function-name ipfilter-lambda \
+  --zip-file fileb://function.zip
+*/
+// Test the Lambda function
+/*
+aws lambda invoke \
+  --function-name ipfilter-lambda \
+  --payload '{"minify": true}' \
+  output.json
+*/
+
+// metaCache outlives a single invocation while the execution environment
+// stays warm, so repeated runs revalidate with If-None-Match instead of
+// downloading the whole meta document again.
+var metaCache ipfilter.Cache = ipfilter.NewMemoryCache()
+
+// lastPolicy is the policy returned by the previous warm invocation. It is
+// the guardrails' yardstick when the caller does not send previous_policy.
+var lastPolicy []byte
+
+// lastApplied is the policy the previous warm scheduled run applied, or found
+// already applied. Only scheduled runs set it, so a direct or HTTP
+// invocation cannot make the schedule skip an apply it never made.
+var lastApplied []byte
+
+// Input structure for Lambda. The settings are the CLI's flags, with
+// underscores for dashes; fields left out keep the value from the config
+// file, the environment or the CLI's defaults (see newInput).
+type Input struct {
+	pipeline.Settings
+
+	// PreviousPolicy is the guardrails' yardstick, like the CLI's --previous.
+	PreviousPolicy json.RawMessage `json:"previous_policy,omitempty"`
+
+	// Apply, when set, also sets the generated policy on ECR repositories.
+	Apply *ApplyInput `json:"apply,omitempty"`
+}
+
+// configData is the pipeline.ConfigEnv file, loaded once per execution
+// environment.
+var configData []byte
+
+// newInput starts an Input from the settings of the pipeline.ConfigEnv file
+// and the IPFILTER_* environment variables. Payload fields decoded on top
+// of it take precedence, as flags do on the CLI.
+func newInput(ctx context.Context) (Input, error) {
+	if location := os.Getenv(pipeline.ConfigEnv); location != "" && configData == nil {
+		b, err := pipeline.LoadConfig(ctx, location)
+		if err != nil {
+			return Input{}, fmt.Errorf("loading config: %w", err)
+		}
+		configData = b
+	}
+	settings, err := pipeline.ResolveSettings(configData, os.LookupEnv, nil)
+	return Input{Settings: settings}, err
+}
+
+// parseInput decodes payload on top of newInput.
+func parseInput(ctx context.Context, payload []byte) (Input, error) {
+	in, err := newInput(ctx)
+	if err != nil {
+		return in, err
+	}
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return in, fmt.Errorf("parsing input: %w", err)
+	}
+	return in, nil
+}
+
+// ApplyInput mirrors the flags of the apply command. The repositories are
+// selected by the top-level settings, as for rollout targets.
+//
+//	{"repositories": ["app", "base-images"], "region": "eu-west-1", "apply": {"dry_run": true}}
+type ApplyInput struct {
+	DryRun bool `json:"dry_run,omitempty"`
+	Merge  bool `json:"merge,omitempty"`
+	// RollbackOnFailure restores every changed repository if any fails.
+	// The journal only lives for the invocation.
+	RollbackOnFailure bool `json:"rollback_on_failure,omitempty"`
+}
+
+// applyOutput is returned instead of the bare policy when Input.Apply is set.
+type applyOutput struct {
+	Policy json.RawMessage       `json:"policy"`
+	Apply  *ipfilter.ApplyReport `json:"apply"`
+}
+
+type Output struct {
+	Policy string `json:"policy"`
+}
+
+// Handler serves direct invocations, whose payload is an Input, EventBridge
+// scheduled events (see handleScheduled) and HTTP requests from API Gateway
+// or a Function URL (see handleHTTP).
+func Handler(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	if event, ok := scheduledEvent(payload); ok {
+		return handleScheduled(ctx, event)
+	}
+	if req, ok := httpRequest(payload); ok {
+		return handleHTTP(ctx, req)
+	}
+	in, err := parseInput(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return handleDirect(ctx, in)
+}
+
+// generate runs the pipeline for a Lambda input. previous is the
+// guardrails' yardstick.
+func generate(ctx context.Context, in Input, previous []byte) (*ipfilter.Result, error) {
+	fetcher, err := in.Fetcher(metaCache, log.Printf)
+	if err != nil {
+		return nil, err
+	}
+	opts := in.Options(fetcher)
+	opts.Previous = previous
+
+	result, err := ipfilter.Generate(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("WARNING (force): %s", warning)
+	}
+	return result, nil
+}
+
+// previousPolicy is the caller's previous_policy, else the last policy this
+// warm environment produced.
+func (in Input) previousPolicy() []byte {
+	if in.PreviousPolicy != nil {
+		return []byte(in.PreviousPolicy)
+	}
+	return lastPolicy
+}
+
+func handleDirect(ctx context.Context, in Input) (json.RawMessage, error) {
+	result, err := generate(ctx, in, in.previousPolicy())
+	if err != nil {
+		return nil, err
+	}
+	policy := result.Policy
+	lastPolicy = policy
+
+	if in.Apply != nil {
+		return applyFromLambda(ctx, policy, in)
+	}
+
+	// If minified = true → return raw unformatted bytes
+	if in.Minify {
+		return json.RawMessage(policy), nil
+	}
+
+	// Otherwise → pretty format it
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, policy, "", "  "); err != nil {
+		return nil, err
+	}
+
+	//return json.RawMessage(pretty.Bytes()), nil
+	return pretty.Bytes(), nil
+}
+
+// applyFromLambda sets policy on the requested repositories. Any failed
+// repository fails the invocation, after the full report has been logged.
+func applyFromLambda(ctx context.Context, policy []byte, in Input) (json.RawMessage, error) {
+	report, err := applyInput(ctx, policy, in)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(applyOutput{Policy: policy, Apply: report})
+	if err != nil {
+		return nil, err
+	}
+	if err := report.Err(); err != nil {
+		log.Printf("Apply report: %s", out)
+		return nil, err
+	}
+	return out, nil
+}
+
+// applyInput runs ApplyPolicy as described by input.Apply, on the
+// repositories, registry and region selected by input's settings.
+func applyInput(ctx context.Context, policy []byte, input Input) (*ipfilter.ApplyReport, error) {
+	in := input.Apply
+	filter, err := input.RepositoryFilter()
+	if err != nil {
+		return nil, err
+	}
+	client, err := pipeline.NewECRClient(ctx, input.Region)
+	if err != nil {
+		return nil, err
+	}
+	return ipfilter.ApplyPolicy(ctx, client, policy, ipfilter.ApplyOptions{
+		Repositories:      input.Repositories,
+		Filter:            filter,
+		RegistryID:        input.RegistryID,
+		DryRun:            in.DryRun,
+		Merge:             in.Merge,
+		RollbackOnFailure: in.RollbackOnFailure,
+		Guardrails:        input.Guardrails(),
+		Logf:              log.Printf,
+	})
+}
+
+// Detected reports whether the process runs inside the Lambda runtime.
+func Detected() bool {
+	return os.Getenv("AWS_LAMBDA_RUNTIME_API") != ""
+}
+
+// Start hands the process to the Lambda runtime; it does not return.
+func Start() {
+	lambda.Start(Handler)
+}
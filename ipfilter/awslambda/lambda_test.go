@@ -0,0 +1,274 @@
+package awslambda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+func TestScheduledEventDetection(t *testing.T) {
+	scheduled := `{"version":"0","id":"abc","detail-type":"Scheduled Event","source":"aws.events","time":"2025-01-01T00:00:00Z","detail":{}}`
+	if event, ok := scheduledEvent([]byte(scheduled)); !ok || event.ID != "abc" {
+		t.Errorf("Expected a scheduled event, but got %v / %v", event, ok)
+	}
+	for _, payload := range []string{`{"minify": true}`, `{"source":"aws.ecr","detail-type":"ECR Image Action"}`, `[]`} {
+		if _, ok := scheduledEvent([]byte(payload)); ok {
+			t.Errorf("Expected %s not to be a scheduled event", payload)
+		}
+	}
+}
+
+// serveMeta serves the raw-data.json fixture as a meta document with an
+// ETag, answering 304 to a matching If-None-Match, and returns the Input
+// JSON pointing at it.
+func serveMeta(t *testing.T) string {
+	raw, err := os.ReadFile("../raw-data.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(raw)
+	}))
+	t.Cleanup(srv.Close)
+	lastPolicy, lastApplied, metaCache = nil, nil, ipfilter.NewMemoryCache()
+	return `{"github_url": "` + srv.URL + `/meta", "github_token_env": "IPFILTER_TEST_NO_TOKEN"}`
+}
+
+// fakeECR counts SetRepositoryPolicy calls and fails them while fail is set.
+// Only the calls of a plain apply to named repositories are implemented.
+type fakeECR struct {
+	ipfilter.ECRClient
+	fail bool
+	sets int
+}
+
+func (f *fakeECR) SetRepositoryPolicy(ctx context.Context, in *ecr.SetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.SetRepositoryPolicyOutput, error) {
+	f.sets++
+	if f.fail {
+		return nil, errors.New("access denied")
+	}
+	return &ecr.SetRepositoryPolicyOutput{RepositoryName: in.RepositoryName, PolicyText: in.PolicyText}, nil
+}
+
+// useFakeECR makes applies go to a fakeECR for the rest of the test.
+func useFakeECR(t *testing.T) *fakeECR {
+	f := &fakeECR{}
+	orig := pipeline.NewECRClient
+	pipeline.NewECRClient = func(ctx context.Context, region string) (ipfilter.ECRClient, error) {
+		return f, nil
+	}
+	t.Cleanup(func() { pipeline.NewECRClient = orig })
+	return f
+}
+
+// withApply adds an apply to the repository "app" to an Input JSON.
+func withApply(input string) string {
+	return strings.TrimSuffix(input, "}") + `, "repositories": ["app"], "apply": {}}`
+}
+
+// scheduledRun invokes the handler with a scheduled event.
+func scheduledRun(t *testing.T) (ScheduledResult, error) {
+	t.Helper()
+	event := []byte(`{"id":"run-1","detail-type":"Scheduled Event","source":"aws.events","detail":{}}`)
+	var res ScheduledResult
+	out, err := Handler(context.Background(), event)
+	if err != nil {
+		return res, err
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		t.Fatalf("Unexpected output %s: %v", out, err)
+	}
+	return res, nil
+}
+
+func TestScheduledRunComparesWithLastPolicy(t *testing.T) {
+	t.Setenv(scheduledInputEnv, serveMeta(t))
+	event := []byte(`{"id":"run-1","detail-type":"Scheduled Event","source":"aws.events","detail":{}}`)
+
+	var results []ScheduledResult
+	for i := 0; i < 2; i++ {
+		out, err := Handler(context.Background(), event)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var res ScheduledResult
+		if err := json.Unmarshal(out, &res); err != nil {
+			t.Fatalf("Unexpected output %s: %v", out, err)
+		}
+		results = append(results, res)
+	}
+
+	if !results[0].Changed || results[0].EventID != "run-1" || results[0].CIDRCount == 0 {
+		t.Errorf("Expected the first run to report a new policy, but got %+v", results[0])
+	}
+	if results[1].Changed || results[1].PolicySHA256 != results[0].PolicySHA256 {
+		t.Errorf("Expected the second run to be unchanged, but got %+v", results[1])
+	}
+}
+
+func TestScheduledRunRetriesFailedApply(t *testing.T) {
+	t.Setenv(scheduledInputEnv, withApply(serveMeta(t)))
+	client := useFakeECR(t)
+
+	client.fail = true
+	if _, err := scheduledRun(t); err == nil {
+		t.Fatalf("Expected the failed apply to fail the run")
+	}
+
+	// The upstream document is now cached and answers 304, but the policy
+	// was never applied, so the next run must try again.
+	client.fail = false
+	res, err := scheduledRun(t)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !res.NotModified || !res.Changed || res.Apply == nil || client.sets != 2 {
+		t.Errorf("Expected the second run to apply again from the cache, but got %+v after %d sets", res, client.sets)
+	}
+
+	res, err = scheduledRun(t)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Changed || client.sets != 2 {
+		t.Errorf("Expected the third run to find the policy applied, but got %+v after %d sets", res, client.sets)
+	}
+}
+
+func TestScheduledRunAfterHTTPFetch(t *testing.T) {
+	input := serveMeta(t)
+	t.Setenv(httpInputEnv, input)
+	t.Setenv(scheduledInputEnv, withApply(input))
+	client := useFakeECR(t)
+
+	req := events.APIGatewayV2HTTPRequest{Version: "2.0", RawPath: "/policy"}
+	req.RequestContext.HTTP.Method = "GET"
+	payload, _ := json.Marshal(req)
+	if _, err := Handler(context.Background(), payload); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A direct invocation without apply remembers its policy too.
+	if _, err := Handler(context.Background(), []byte(input)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	res, err := scheduledRun(t)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !res.NotModified || !res.Changed || client.sets != 1 {
+		t.Errorf("Expected the schedule to apply the policy nobody applied, but got %+v after %d sets", res, client.sets)
+	}
+}
+
+func TestHTTPRoutes(t *testing.T) {
+	t.Setenv(httpInputEnv, serveMeta(t))
+
+	request := func(method, path string, query map[string]string) events.APIGatewayV2HTTPResponse {
+		t.Helper()
+		req := events.APIGatewayV2HTTPRequest{Version: "2.0", RawPath: path, QueryStringParameters: query}
+		req.RequestContext.Stage = "prod"
+		req.RequestContext.HTTP.Method = method
+		payload, _ := json.Marshal(req)
+		out, err := Handler(context.Background(), payload)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var resp events.APIGatewayV2HTTPResponse
+		if err := json.Unmarshal(out, &resp); err != nil {
+			t.Fatalf("Unexpected output %s: %v", out, err)
+		}
+		return resp
+	}
+
+	resp := request("GET", "/prod/policy", map[string]string{"minify": "true"})
+	if resp.StatusCode != 200 || resp.Headers["Content-Type"] != "application/json" || strings.Contains(resp.Body, "\n") {
+		t.Errorf("Expected a minified JSON policy, but got %d %v %.60s", resp.StatusCode, resp.Headers, resp.Body)
+	}
+
+	resp = request("GET", "/prod/cidrs", map[string]string{"format": "text"})
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Headers["Content-Type"], "text/plain") {
+		t.Fatalf("Expected a text CIDR list, but got %d %v", resp.StatusCode, resp.Headers)
+	}
+	first := strings.SplitN(resp.Body, "\n", 2)[0]
+	prefix := netip.MustParsePrefix(first)
+
+	resp = request("GET", "/prod/check", map[string]string{"ip": prefix.Addr().String()})
+	var check ipfilter.IPExplanation
+	json.Unmarshal([]byte(resp.Body), &check)
+	if resp.StatusCode != 200 || !check.Allowed || check.CIDR != first || len(check.Sources) == 0 {
+		t.Errorf("Expected %s to be allowed by %s, but got %d %s", prefix.Addr(), first, resp.StatusCode, resp.Body)
+	}
+	resp = request("GET", "/prod/check", map[string]string{"ip": "192.0.2.1"})
+	json.Unmarshal([]byte(resp.Body), &check)
+	if resp.StatusCode != 200 || check.Allowed {
+		t.Errorf("Expected 192.0.2.1 to be denied, but got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		query        map[string]string
+		status       int
+	}{
+		{"GET", "/prod/check", map[string]string{"ip": "not-an-ip"}, 400},
+		{"GET", "/prod/cidrs", map[string]string{"format": "xml"}, 400},
+		{"GET", "/prod/policy", map[string]string{"keys": "no-such-key"}, 400},
+		{"POST", "/prod/policy", nil, 405},
+		{"GET", "/prod/nope", nil, 404},
+	} {
+		if resp := request(tc.method, tc.path, tc.query); resp.StatusCode != tc.status {
+			t.Errorf("Expected %d for %s %s %v, but got %d %s", tc.status, tc.method, tc.path, tc.query, resp.StatusCode, resp.Body)
+		}
+	}
+	if lastPolicy != nil {
+		t.Errorf("Expected HTTP requests to leave the last policy alone")
+	}
+}
+
+func TestConfigFileUnderPayload(t *testing.T) {
+	input := serveMeta(t)
+	var settings map[string]any
+	json.Unmarshal([]byte(input), &settings)
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	body := fmt.Sprintf("github_url: %s\ngithub_token_env: %s\nmin_cidrs: 1000\nminify: true\n", settings["github_url"], settings["github_token_env"])
+	if err := os.WriteFile(config, []byte(body), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv(pipeline.ConfigEnv, config)
+	configData = nil
+	t.Cleanup(func() { configData = nil })
+
+	if _, err := Handler(context.Background(), []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "minimum of 1000") {
+		t.Errorf("Expected the config's min_cidrs to refuse the policy, but got %v", err)
+	}
+	t.Setenv("IPFILTER_MIN_CIDRS", "500")
+	if _, err := Handler(context.Background(), []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "minimum of 500") {
+		t.Errorf("Expected the environment to override the config, but got %v", err)
+	}
+	out, err := Handler(context.Background(), []byte(`{"min_cidrs": 1}`))
+	if err != nil {
+		t.Fatalf("Expected the payload to override the environment, but got %v", err)
+	}
+	if strings.Contains(string(out), "\n") {
+		t.Errorf("Expected the config's minify to apply, but got %s", out)
+	}
+}
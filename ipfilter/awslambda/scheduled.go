@@ -0,0 +1,131 @@
+package awslambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// scheduledInputEnv holds the Input, as JSON, used for scheduled runs. A
+// plain EventBridge schedule carries no payload of its own.
+const scheduledInputEnv = "IPFILTER_SCHEDULED_INPUT"
+
+// ScheduledResult is returned (and logged) by a scheduled run.
+type ScheduledResult struct {
+	EventID string    `json:"event_id"`
+	Time    time.Time `json:"time"`
+	// Changed is false when the policy is equivalent to the last one, in
+	// which case nothing is applied.
+	Changed bool `json:"changed"`
+	// NotModified means the upstream meta document had not changed; the
+	// policy was built again from the cached copy.
+	NotModified  bool   `json:"not_modified,omitempty"`
+	PolicySHA256 string `json:"policy_sha256,omitempty"`
+	MetaSHA256   string `json:"meta_sha256,omitempty"`
+	CIDRCount    int    `json:"cidr_count,omitempty"`
+	// Diff is set when a last policy was known and the ranges changed.
+	Diff     *ipfilter.PolicyDiff  `json:"diff,omitempty"`
+	Warnings []string              `json:"warnings,omitempty"`
+	Apply    *ipfilter.ApplyReport `json:"apply,omitempty"`
+}
+
+// scheduledEvent recognises an EventBridge "Scheduled Event" payload.
+func scheduledEvent(payload []byte) (*events.EventBridgeEvent, bool) {
+	var event events.EventBridgeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, false
+	}
+	if event.Source != "aws.events" && event.Source != "aws.scheduler" {
+		return nil, false
+	}
+	if event.DetailType != "Scheduled Event" {
+		return nil, false
+	}
+	return &event, true
+}
+
+// scheduledInput reads the Input for a scheduled run from newInput and
+// scheduledInputEnv, overlaid with any fields in the event detail.
+func scheduledInput(ctx context.Context, event *events.EventBridgeEvent) (Input, error) {
+	in, err := newInput(ctx)
+	if err != nil {
+		return in, err
+	}
+	if env := os.Getenv(scheduledInputEnv); env != "" {
+		if err := json.Unmarshal([]byte(env), &in); err != nil {
+			return in, fmt.Errorf("parsing %s: %w", scheduledInputEnv, err)
+		}
+	}
+	if detail := bytes.TrimSpace(event.Detail); len(detail) > 0 && !bytes.Equal(detail, []byte("null")) {
+		if err := json.Unmarshal(detail, &in); err != nil {
+			return in, fmt.Errorf("parsing event detail: %w", err)
+		}
+	}
+	return in, nil
+}
+
+// handleScheduled runs fetch → build → compare with lastApplied → apply.
+// A policy is only remembered once it has been applied, so a failed apply is
+// retried on the next schedule. A cold start has nothing applied yet and
+// always applies, which is harmless because applying is idempotent.
+func handleScheduled(ctx context.Context, event *events.EventBridgeEvent) (json.RawMessage, error) {
+	in, err := scheduledInput(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	res := ScheduledResult{EventID: event.ID, Time: event.Time}
+
+	result, err := generate(ctx, in, in.previousPolicy())
+	if err != nil {
+		return nil, err
+	}
+	res.Warnings = result.Warnings
+	res.MetaSHA256 = result.MetaSHA256
+	res.NotModified = result.NotModified
+	policy := result.Policy
+	res.PolicySHA256 = ipfilter.PolicySHA256(policy)
+	res.CIDRCount = len(result.CIDRs)
+
+	res.Changed = true
+	if lastApplied != nil {
+		same, err := ipfilter.PoliciesEquivalent(lastApplied, policy)
+		if err == nil && same {
+			res.Changed = false
+		} else if diff, err := ipfilter.DiffPolicies(lastApplied, policy); err == nil {
+			res.Diff = diff
+		}
+	}
+	if !res.Changed {
+		log.Printf("Policy unchanged (sha256 %.12s); nothing to apply", res.PolicySHA256)
+		lastPolicy = policy
+		return json.Marshal(res)
+	}
+
+	if in.Apply != nil {
+		report, err := applyInput(ctx, policy, in)
+		if err != nil {
+			return nil, err
+		}
+		res.Apply = report
+		if err := report.Err(); err != nil {
+			out, _ := json.Marshal(res)
+			log.Printf("Scheduled run: %s", out)
+			return nil, err
+		}
+	}
+	lastPolicy, lastApplied = policy, policy
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Scheduled run: %s", out)
+	return out, nil
+}
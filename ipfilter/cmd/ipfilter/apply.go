@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// runApply sets a generated policy on ECR repositories, replacing what
+// `aws ecr set-repository-policy` used to do by hand.
+//
+//	ipfilter apply --policy policy.json --repositories app,base-images [--dry-run]
+//	ipfilter apply --policy policy.json --tag ci-locked=true --prefix team-a/
+//
+// Every run that changes a repository is journaled under --journal-dir, so
+// it can be undone later with `ipfilter rollback --run-id <id>`.
+func runApply(args []string) {
+	fs := newFlagSet("apply")
+	policyFile := fs.String("policy", "policy.json", "Policy document to apply; '-' reads stdin")
+	dryRun := fs.Bool("dry-run", false, "Show what would be applied without changing any repository")
+	merge := fs.Bool("merge", false, "Keep existing statements and only replace or insert the deny statement; a policy that cannot be parsed fails its repository, which rolls back the run unless --rollback-on-failure=false")
+	journalDir := fs.String("journal-dir", defaultJournalDir, "Directory for run journals; empty disables journaling")
+	rollbackOnFailure := fs.Bool("rollback-on-failure", true, "Restore every changed repository if any repository fails")
+	format := fs.String("format", "text", "Report format: text or json")
+	flagged := pipeline.DefaultSettings()
+	fs.IntVar(&flagged.MinCIDRs, "min-cidrs", flagged.MinCIDRs, "Refuse policies with fewer allowed CIDRs than this (an empty list is always refused)")
+	fs.BoolVar(&flagged.Force, "force", flagged.Force, "Apply the policy even if it fails validation or --min-cidrs")
+	flagged.RegisterSelectFlags(fs)
+	parseFlags(fs, args)
+	settings := resolveSettings(fs)
+
+	ifLog := logger()
+	ctx := context.Background()
+
+	policy, err := readInput(*policyFile)
+	if err != nil {
+		log.Fatalf("Error reading policy: %v", err)
+	}
+	filter, err := settings.RepositoryFilter()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	client, err := pipeline.NewECRClient(ctx, settings.Region)
+	if err != nil {
+		log.Fatalf("Error configuring AWS: %v", err)
+	}
+
+	var journal *ipfilter.Journal
+	if *journalDir != "" && !*dryRun {
+		journal = ipfilter.NewJournal(*journalDir)
+		journal.Region = settings.Region
+	}
+
+	report, err := ipfilter.ApplyPolicy(ctx, client, policy, ipfilter.ApplyOptions{
+		Repositories:      settings.Repositories,
+		Filter:            filter,
+		RegistryID:        settings.RegistryID,
+		DryRun:            *dryRun,
+		Merge:             *merge,
+		Journal:           journal,
+		RollbackOnFailure: *rollbackOnFailure,
+		Guardrails:        ipfilter.Guardrails{MinCIDRs: settings.MinCIDRs, Force: settings.Force},
+		Logf:              ifLog,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if report.RunID != "" {
+		ifLog("Journaled run %s to %s", report.RunID, journal.Path())
+	}
+	if err := printReport(report, *format); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+// printReport writes an apply report to stdout.
+func printReport(report *ipfilter.ApplyReport, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "text":
+		fmt.Printf("Policy sha256 %s\n", report.PolicySHA256)
+		if report.RunID != "" {
+			fmt.Printf("Run ID %s\n", report.RunID)
+		}
+		for _, res := range report.Results {
+			switch {
+			case res.Error != "":
+				fmt.Printf("%-8s %s: %s\n", res.Status, res.Repository, res.Error)
+			case res.Statement != "":
+				fmt.Printf("%-8s %s (statement %s, sha256 %.12s)\n", res.Status, res.Repository, res.Statement, res.PolicySHA256)
+			default:
+				fmt.Printf("%-8s %s\n", res.Status, res.Repository)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"log/slog"
+	"os"
+	"runtime"
+)
+
+// command is one `ipfilter <name>` subcommand.
+type command struct {
+	name    string
+	args    string // positional arguments, for the usage line
+	summary string
+	run     func(args []string)
+}
+
+// commands lists every subcommand in help order. It is filled in by init
+// because runHelp refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"generate", "", "Generate the deny policy from the GitHub meta document (the default command)", runGenerate},
+		{"fetch", "", "Save the meta document with its fetch time and SHA-256 for offline runs", runFetch},
+		{"diff", "OLD_POLICY NEW_POLICY", "Show which CIDRs two policies allow differently", runDiff},
+		{"validate", "POLICY...", "Check policy files for structural problems and guardrail violations", runValidate},
+		{"check-ip", "IP...", "Report whether addresses are allowed by a policy, and by which range", runCheckIP},
+		{"evaluate", "", "Simulate a request against a policy with IAM's evaluation rules", runEvaluate},
+		{"apply", "", "Set a policy on ECR repositories", runApply},
+		{"drift", "", "Compare the policies deployed on ECR with the expected one", runDrift},
+		{"rollout", "", "Apply a policy across accounts and regions", runRollout},
+		{"rollback", "", "Undo an apply run from its journal", runRollback},
+		{"history", "list|show", "List or show previously generated policies", runHistory},
+		{"config", "validate|show", "Check the config file, or print the resolved settings", runConfig},
+		{"version", "", "Print the version", runVersion},
+		{"help", "[COMMAND]", "Show help for a command", runHelp},
+	}
+}
+
+// aliases are older command names kept for existing scripts.
+var aliases = map[string]string{
+	"snapshot": "fetch",
+}
+
+func findCommand(name string) *command {
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// globalFlags are accepted by every command, before or after its name.
+type globalFlags struct {
+	quiet     bool
+	config    string
+	logFormat string
+}
+
+var globals = globalFlags{logFormat: "text"}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&g.quiet, "quiet", g.quiet, "Keeps log output to zilch, only errors will be shown")
+	fs.StringVar(&g.config, "config", g.config, "YAML or JSON settings file, or s3://bucket/key (default: $IPFILTER_CONFIG); environment variables and flags take precedence")
+	fs.StringVar(&g.logFormat, "log-format", g.logFormat, "Log format: text or json")
+}
+
+// splitCommand finds the command in the arguments, after any global flags.
+// Anything else, including a bare flag list, runs the default "generate"
+// command with all arguments, as the CLI did before it had commands.
+func splitCommand(args []string) (string, []string) {
+	fs := flag.NewFlagSet("ipfilter", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	probe := globals
+	probe.register(fs)
+	err := fs.Parse(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return "help", nil
+	case err != nil || fs.NArg() == 0:
+		return "generate", args
+	}
+	globals = probe
+	return fs.Arg(0), fs.Args()[1:]
+}
+
+// newFlagSet returns the flag set of a command, with the global flags and
+// a usage message built from the command table. Parse errors are handled by
+// parseFlags rather than the flag package, whose exit code 2 would read as
+// "changed" to callers of --check, drift, check-ip and evaluate.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	globals.register(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		if cmd := findCommand(name); cmd != nil {
+			fmt.Fprintf(out, "Usage: ipfilter %s [flags] %s\n\n%s.\n\nFlags:\n", name, cmd.args, cmd.summary)
+		} else {
+			fmt.Fprintf(out, "Usage: ipfilter %s [flags]\n\nFlags:\n", name)
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses a command's arguments and sets up logging from the
+// global flags. -h prints the usage and exits 0; a bad flag exits 1 after
+// the flag package has reported it.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	switch err := fs.Parse(args); {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(exitUnchanged)
+	case err != nil:
+		os.Exit(exitError)
+	}
+	switch globals.logFormat {
+	case "text":
+	case "json":
+		// slog also takes over the log package, so log.Printf lines become
+		// {"time":...,"level":"INFO","msg":...} records.
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	default:
+		log.Fatalf("Unsupported log format: %s", globals.logFormat)
+	}
+}
+
+// usageError prints the usage of a command called with the wrong arguments
+// and exits 1.
+func usageError(fs *flag.FlagSet) {
+	fs.Usage()
+	os.Exit(exitError)
+}
+
+// configLocation is --config, else the pipeline.ConfigEnv variable; empty
+// when there is no config file.
+func configLocation() string {
+	if globals.config != "" {
+		return globals.config
+	}
+	return os.Getenv(pipeline.ConfigEnv)
+}
+
+// resolveSettings returns the settings of a run: the defaults, overlaid with
+// the config file, the IPFILTER_* environment variables and the settings
+// flags set explicitly on fs.
+func resolveSettings(fs *flag.FlagSet) pipeline.Settings {
+	var config []byte
+	if location := configLocation(); location != "" {
+		b, err := pipeline.LoadConfig(context.Background(), location)
+		if err != nil {
+			log.Fatalf("Error reading config: %v", err)
+		}
+		config = b
+	}
+	settings, err := pipeline.ResolveSettings(config, os.LookupEnv, fs)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	return settings
+}
+
+// runVersion prints the version and the Go build it came from.
+func runVersion(args []string) {
+	fs := newFlagSet("version")
+	parseFlags(fs, args)
+	fmt.Printf("ipfilter version %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// runHelp lists the commands, or shows the flags of one.
+//
+//	ipfilter help [COMMAND]
+func runHelp(args []string) {
+	if len(args) > 0 && args[0] != "help" {
+		cmd := findCommand(args[0])
+		if cmd == nil {
+			log.Fatalf("Unknown command: %s", args[0])
+		}
+		cmd.run([]string{"-h"})
+		return
+	}
+	printCommands(os.Stdout)
+}
+
+func printCommands(out io.Writer) {
+	fmt.Fprintf(out, "Usage: ipfilter [global flags] <command> [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nGlobal flags:\n")
+	fs := flag.NewFlagSet("ipfilter", flag.ContinueOnError)
+	fs.SetOutput(out)
+	g := globalFlags{logFormat: "text"}
+	g.register(fs)
+	fs.PrintDefaults()
+	fmt.Fprintf(out, "\nRun 'ipfilter help <command>' for the flags of a command.\n")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{nil, "generate", nil},
+		{[]string{"diff", "a.json", "b.json"}, "diff", []string{"a.json", "b.json"}},
+		{[]string{"--quiet", "--log-format", "json", "validate", "p.json"}, "validate", []string{"p.json"}},
+		// The flat CLI of earlier releases still runs generate.
+		{[]string{"--minify", "--output", "p.json"}, "generate", []string{"--minify", "--output", "p.json"}},
+		{[]string{"-h"}, "help", nil},
+	}
+	for _, tt := range tests {
+		globals = globalFlags{logFormat: "text"}
+		name, args := splitCommand(tt.args)
+		if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("splitCommand(%q): Expected %s %q, but got %s %q", tt.args, tt.wantName, tt.wantArgs, name, args)
+		}
+	}
+	globals = globalFlags{logFormat: "text"}
+	splitCommand([]string{"--quiet", "--log-format", "json", "version"})
+	if !globals.quiet || globals.logFormat != "json" {
+		t.Errorf("Expected global flags before the command to be kept, but got %+v", globals)
+	}
+	if findCommand("snapshot") == nil || findCommand("snapshot").name != "fetch" {
+		t.Errorf("Expected snapshot to be an alias of fetch")
+	}
+}
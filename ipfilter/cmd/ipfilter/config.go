@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// runConfig inspects the settings file given by --config or IPFILTER_CONFIG.
+//
+//	ipfilter config validate [FILE]
+//	ipfilter config show [settings flags]
+func runConfig(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: ipfilter config validate|show [flags]")
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		fmt.Fprintln(os.Stderr, "Usage: ipfilter config validate|show [flags]\n\nRun 'ipfilter config validate -h' or 'ipfilter config show -h' for their flags.")
+	case "validate":
+		runConfigValidate(args[1:])
+	case "show":
+		runConfigShow(args[1:])
+	default:
+		log.Fatalf("Unknown config command %q; expected validate or show", args[0])
+	}
+}
+
+// runConfigValidate reports unknown keys, bad values and conflicting
+// settings. It exits 0 for a valid file and 1 otherwise.
+func runConfigValidate(args []string) {
+	fs := newFlagSet("config validate")
+	parseFlags(fs, args)
+	location := configLocation()
+	if fs.NArg() > 0 {
+		location = fs.Arg(0)
+	}
+	if location == "" {
+		log.Fatalf("Error: no config file; pass one or set --config or %s", pipeline.ConfigEnv)
+	}
+
+	config, err := pipeline.LoadConfig(context.Background(), location)
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+	problems := pipeline.ValidateConfig(config)
+	for _, problem := range problems {
+		fmt.Printf("%s: %s\n", location, problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(exitError)
+	}
+	logger()("%s is valid", location)
+}
+
+// runConfigShow prints the settings a run would use, after the config file,
+// environment variables and flags have been applied, in the payload schema.
+func runConfigShow(args []string) {
+	fs := newFlagSet("config show")
+	flagged := pipeline.DefaultSettings()
+	flagged.RegisterGenerateFlags(fs)
+	flagged.RegisterFetchFlags(fs)
+	parseFlags(fs, args)
+	settings := resolveSettings(fs)
+
+	b, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding settings: %v", err)
+	}
+	fmt.Println(string(b))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"log"
+)
+
+// runDiff prints which CIDRs two policies allow differently.
+//
+//	ipfilter diff [--format text|json|markdown] old-policy.json new-policy.json
+func runDiff(args []string) {
+	fs := newFlagSet("diff")
+	format := fs.String("format", "text", "Output format: text, json or markdown")
+	parseFlags(fs, args)
+	if fs.NArg() != 2 {
+		usageError(fs)
+	}
+
+	var docs [2][]byte
+	for i, path := range fs.Args() {
+		b, err := readInput(path)
+		if err != nil {
+			log.Fatalf("Error reading policy: %v", err)
+		}
+		docs[i] = b
+	}
+
+	diff, err := ipfilter.DiffPolicies(docs[0], docs[1])
+	if err != nil {
+		log.Fatalf("Error comparing policies: %v", err)
+	}
+
+	switch *format {
+	case "text":
+		fmt.Print(diff.Text())
+	case "markdown":
+		fmt.Print(diff.Markdown())
+	case "json":
+		b, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			log.Fatalf("Error encoding diff: %v", err)
+		}
+		fmt.Println(string(b))
+	default:
+		log.Fatalf("Unsupported format: %s", *format)
+	}
+}
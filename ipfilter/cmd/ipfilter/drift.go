@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// runDrift compares the policies deployed on ECR repositories with the one
+// the tool would generate now. It exits 0 when every repository is
+// compliant, 2 when any has drifted or lacks the policy and 1 on error.
+//
+//	ipfilter drift --tag ci-locked=true [--merge] [--policy policy.json]
+func runDrift(args []string) {
+	fs := newFlagSet("drift")
+	policyFile := fs.String("policy", "", "Compare against this policy file instead of generating the expected policy")
+	inputFile := fs.String("input-file", "", "Read the meta document (raw or a snapshot) from this file instead of fetching it; '-' reads stdin")
+	merge := fs.Bool("merge", false, "Policies were applied with --merge: only compare the deny statement")
+	format := fs.String("format", "text", "Report format: text or json")
+	flagged := pipeline.DefaultSettings()
+	flagged.RegisterSelectFlags(fs)
+	flagged.RegisterGenerateFlags(fs)
+	flagged.RegisterFetchFlags(fs)
+	parseFlags(fs, args)
+	settings := resolveSettings(fs)
+
+	ifLog := logger()
+	ctx := context.Background()
+
+	var expected []byte
+	if *policyFile != "" {
+		b, err := readInput(*policyFile)
+		if err != nil {
+			log.Fatalf("Error reading policy: %v", err)
+		}
+		expected = b
+	} else {
+		fetcher, err := settings.Fetcher(nil, ifLog)
+		if err != nil {
+			log.Fatalf("Error configuring HTTP client: %v", err)
+		}
+		opts := settings.Options(fetcher)
+		if *inputFile != "" {
+			if opts.Input, err = readInput(*inputFile); err != nil {
+				log.Fatalf("Error reading input: %v", err)
+			}
+		}
+		result, err := ipfilter.Generate(ctx, opts)
+		if err != nil {
+			log.Fatalf("Error generating policy: %v", err)
+		}
+		expected = result.Policy
+	}
+
+	filter, err := settings.RepositoryFilter()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	client, err := pipeline.NewECRClient(ctx, settings.Region)
+	if err != nil {
+		log.Fatalf("Error configuring AWS: %v", err)
+	}
+	report, err := ipfilter.DetectDrift(ctx, client, expected, ipfilter.DriftOptions{
+		Repositories: settings.Repositories,
+		Filter:       filter,
+		RegistryID:   settings.RegistryID,
+		Merge:        *merge,
+		Logf:         ifLog,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Error encoding report: %v", err)
+		}
+		fmt.Println(string(b))
+	case "text":
+		for _, res := range report.Results {
+			line := fmt.Sprintf("%-9s %s", res.Status, res.Repository)
+			if res.Detail != "" {
+				line += ": " + res.Detail
+			}
+			for _, c := range res.Added {
+				line += "\n          + " + c
+			}
+			for _, c := range res.Removed {
+				line += "\n          - " + c
+			}
+			fmt.Println(line)
+		}
+		fmt.Printf("%d compliant, %d drifted, %d missing, %d errors\n",
+			report.Count(ipfilter.DriftCompliant), report.Count(ipfilter.DriftDrifted),
+			report.Count(ipfilter.DriftMissing), report.Count(ipfilter.DriftError))
+	default:
+		log.Fatalf("Unsupported format: %s", *format)
+	}
+
+	switch {
+	case report.Count(ipfilter.DriftError) > 0:
+		os.Exit(exitError)
+	case report.Drifted():
+		os.Exit(exitChanged)
+	}
+}
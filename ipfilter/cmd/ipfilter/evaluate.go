@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+	"strings"
+)
+
+// runEvaluate simulates a request against a policy locally, to check a
+// generated or merged document behaves as intended before it reaches AWS.
+// It exits 2 on an explicit deny and 0 otherwise: an implicit deny only
+// means the repository policy does not allow the request itself.
+//
+//	ipfilter evaluate --policy policy.json --action ecr:BatchGetImage --source-ip 192.0.2.1
+func runEvaluate(args []string) {
+	fs := newFlagSet("evaluate")
+	policyFile := fs.String("policy", "policy.json", "Policy document to evaluate; '-' reads stdin")
+	action := fs.String("action", "ecr:BatchGetImage", "Action of the simulated request")
+	resource := fs.String("resource", "", "Resource ARN of the simulated request, e.g. arn:aws:ecr:eu-west-1:123456789012:repository/app")
+	principal := fs.String("principal", "", "Caller ARN of the simulated request")
+	sourceIP := fs.String("source-ip", "", "Sets the aws:SourceIp condition key")
+	conditions := fs.String("context", "", "Comma-separated key=value condition keys, e.g. aws:SecureTransport=true")
+	format := fs.String("format", "text", "Output format: text or json")
+	parseFlags(fs, args)
+
+	policy, err := readInput(*policyFile)
+	if err != nil {
+		log.Fatalf("Error reading policy: %v", err)
+	}
+	req := ipfilter.EvalRequest{
+		Principal: *principal,
+		Action:    *action,
+		Resource:  *resource,
+		Context:   make(map[string]string),
+	}
+	for _, pair := range pipeline.SplitList(*conditions) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			log.Fatalf("Error: invalid context %q: expected key=value", pair)
+		}
+		req.Context[key] = value
+	}
+	if *sourceIP != "" {
+		req.Context["aws:SourceIp"] = *sourceIP
+	}
+
+	ev, err := ipfilter.EvaluatePolicy(policy, req)
+	if err != nil {
+		log.Fatalf("Error evaluating policy: %v", err)
+	}
+
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(ev, "", "  ")
+		if err != nil {
+			log.Fatalf("Error encoding evaluation: %v", err)
+		}
+		fmt.Println(string(b))
+	case "text":
+		fmt.Println(ev.Decision)
+		for _, m := range ev.Matched {
+			fmt.Printf("  %-5s statement %d %s\n", m.Effect, m.Index, m.Sid)
+		}
+	default:
+		log.Fatalf("Unsupported format: %s", *format)
+	}
+	if ev.Decision == ipfilter.DecisionExplicitDeny {
+		os.Exit(exitChanged)
+	}
+}
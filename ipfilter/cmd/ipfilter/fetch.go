@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// runFetch fetches the meta document and saves it together with its fetch
+// time and SHA-256, so air-gapped builds can later use it via --input-file.
+// It was called snapshot before the CLI had commands, and still answers to
+// that name.
+//
+//	ipfilter fetch --output meta-snapshot.json [--raw]
+func runFetch(args []string) {
+	fs := newFlagSet("fetch")
+	output := fs.String("output", "meta-snapshot.json", "Snapshot file to write; empty prints to stdout")
+	raw := fs.Bool("raw", false, "Write the meta document as fetched instead of a snapshot")
+	flagged := pipeline.DefaultSettings()
+	flagged.RegisterFetchFlags(fs)
+	parseFlags(fs, args)
+	settings := resolveSettings(fs)
+
+	ifLog := logger()
+
+	fetcher, err := settings.Fetcher(nil, ifLog)
+	if err != nil {
+		log.Fatalf("Error configuring HTTP client: %v", err)
+	}
+	metaURL, err := ipfilter.MetaURL(settings.GitHubURL)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	res, err := fetcher.Do(context.Background(), metaURL)
+	if err != nil {
+		log.Fatalf("Error fetching GitHub metadata: %v", err)
+	}
+	if *raw {
+		writeOutput(*output, res.Body)
+		if *output != "" {
+			ifLog("Meta document from %s written to %s (fetched %s)", metaURL, *output, res.FetchedAt)
+		}
+		return
+	}
+	snap, err := ipfilter.NewSnapshot(metaURL, res.Body, res.FetchedAt)
+	if err != nil {
+		log.Fatalf("Error creating snapshot: %v", err)
+	}
+	b, err := snap.Marshal()
+	if err != nil {
+		log.Fatalf("Error encoding snapshot: %v", err)
+	}
+	writeOutput(*output, b)
+	if *output != "" {
+		ifLog("Snapshot of %s written to %s (sha256 %s, fetched %s)", metaURL, *output, snap.SHA256, snap.FetchedAt)
+	}
+}
+
+// writeOutput saves b to output, or prints it to stdout when output is empty.
+func writeOutput(output string, b []byte) {
+	if output == "" {
+		fmt.Print(string(b))
+		return
+	}
+	if err := os.WriteFile(output, b, 0644); err != nil {
+		log.Fatalf("failed writing file: %v", err)
+	}
+}
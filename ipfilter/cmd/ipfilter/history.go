@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"log"
+	"os"
+	"strings"
+)
+
+// defaultHistoryDir is where history list and show look by default. generate
+// only records a history when given --history-dir.
+const defaultHistoryDir = ".ipfilter-history"
+
+// runHistory browses the policies recorded by earlier runs.
+//
+//	ipfilter history list [--limit 10]
+//	ipfilter history show [--policy-only] <id|latest>
+func runHistory(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: ipfilter history list|show [flags]")
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		fmt.Fprintln(os.Stderr, "Usage: ipfilter history list|show [flags]\n\nRun 'ipfilter history list -h' or 'ipfilter history show -h' for their flags.")
+	case "list":
+		runHistoryList(args[1:])
+	case "show":
+		runHistoryShow(args[1:])
+	default:
+		log.Fatalf("Unknown history command %q; expected list or show", args[0])
+	}
+}
+
+func runHistoryList(args []string) {
+	fs := newFlagSet("history list")
+	dir := fs.String("history-dir", defaultHistoryDir, "Directory holding the policy history")
+	limit := fs.Int("limit", 0, "Show only the newest N entries; 0 shows all")
+	format := fs.String("format", "text", "Output format: text or json")
+	parseFlags(fs, args)
+
+	records, err := ipfilter.NewHistory(ipfilter.DirStore{Dir: *dir}).List(context.Background())
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[:*limit]
+	}
+
+	switch *format {
+	case "json":
+		if records == nil {
+			records = []*ipfilter.HistoryRecord{}
+		}
+		b, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Println(string(b))
+	case "text":
+		for _, rec := range records {
+			fmt.Printf("%s  %s  %4d CIDRs  meta %.12s  policy %.12s  %s\n",
+				rec.ID, rec.CreatedAt.Format("2006-01-02 15:04:05"), rec.CIDRCount,
+				rec.MetaSHA256, rec.PolicySHA256, strings.Join(rec.Keys, ","))
+		}
+	default:
+		log.Fatalf("Error: unsupported format: %s", *format)
+	}
+}
+
+func runHistoryShow(args []string) {
+	fs := newFlagSet("history show")
+	dir := fs.String("history-dir", defaultHistoryDir, "Directory holding the policy history")
+	policyOnly := fs.Bool("policy-only", false, "Print only the policy document, as it was generated")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		log.Fatalf("Usage: ipfilter history show [flags] <id|latest>")
+	}
+
+	rec, policy, err := ipfilter.NewHistory(ipfilter.DirStore{Dir: *dir}).Get(context.Background(), fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *policyOnly {
+		os.Stdout.Write(policy)
+		return
+	}
+	fmt.Printf("ID:            %s\n", rec.ID)
+	fmt.Printf("Created:       %s\n", rec.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	if rec.MetaURL != "" {
+		fmt.Printf("Meta URL:      %s\n", rec.MetaURL)
+	}
+	fmt.Printf("Meta sha256:   %s\n", rec.MetaSHA256)
+	fmt.Printf("Keys:          %s\n", strings.Join(rec.Keys, ","))
+	fmt.Printf("CIDRs:         %d\n", rec.CIDRCount)
+	fmt.Printf("Policy sha256: %s\n\n", rec.PolicySHA256)
+	fmt.Println(strings.TrimRight(string(policy), "\n"))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"ipfilter/ipfilter/awslambda"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	version = "1.0.0"
+)
+
+// logger returns a log.Printf that stays silent under --quiet.
+func logger() func(string, ...any) {
+	return func(msg string, args ...any) {
+		if !globals.quiet {
+			log.Printf(msg, args...)
+		}
+	}
+}
+
+// readInput reads an offline meta document; "-" means stdin.
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// Exit codes of --check, drift, check-ip and evaluate. Usage errors are
+// errors too, so 2 only ever means a change or a denial.
+const (
+	exitUnchanged = 0
+	exitError     = 1
+	exitChanged   = 2
+)
+
+// checkPolicy compares a freshly generated policy with the one in output and
+// returns the --check exit code. A missing output file counts as a change.
+func checkPolicy(result *ipfilter.Result, output string, ifLog func(string, ...any)) int {
+	if output == "" {
+		log.Printf("Error: --check needs an --output file to compare against")
+		return exitError
+	}
+	current, err := os.ReadFile(output)
+	if errors.Is(err, fs.ErrNotExist) {
+		ifLog("%s does not exist yet", output)
+		return exitChanged
+	}
+	if err != nil {
+		log.Printf("Error reading %s: %v", output, err)
+		return exitError
+	}
+	same, err := ipfilter.PoliciesEquivalent(current, result.Policy)
+	if err != nil {
+		log.Printf("Error comparing with %s: %v", output, err)
+		return exitError
+	}
+	if same {
+		ifLog("%s is up to date", output)
+		return exitUnchanged
+	}
+	ifLog("%s is out of date", output)
+	if diff, err := ipfilter.DiffPolicies(current, result.Policy); err == nil {
+		fmt.Print(diff.Text())
+	}
+	return exitChanged
+}
+
+// Main function
+// ---------------------------------------------------------
+// ENTRY POINT FOR COMMAND LINE TOOL
+// NOTE: Inside the Lambda runtime (AWS_LAMBDA_RUNTIME_API is
+// set) the same binary serves the Lambda handler instead, so
+// it can be deployed as bootstrap. Payload fields use the
+// settings flag names, with underscores for dashes.
+// ---------------------------------------------------------
+func main() {
+	if awslambda.Detected() {
+		awslambda.Start()
+		return
+	}
+
+	name, args := splitCommand(os.Args[1:])
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printCommands(os.Stderr)
+		os.Exit(exitError)
+	}
+	cmd.run(args)
+}
+
+// runGenerate writes the deny policy for the selected meta keys.
+//
+//	ipfilter generate [--output policy.json] [--keys actions,hooks] [--check]
+func runGenerate(args []string) {
+	startTime := time.Now()
+
+	// Command-line flags
+	fs := newFlagSet("generate")
+	source := fs.String("source", "github", "Source provider: only 'github' is supported for now")
+	output := fs.String("output", "policy.json", "Output file for the generated policy")
+	inputFile := fs.String("input-file", "", "Read the meta document (raw or a snapshot) from this file instead of fetching it; '-' reads stdin")
+	check := fs.Bool("check", false, "Compare the generated policy with --output without writing it; exit 0 if unchanged, 2 if changed, 1 on error")
+	historyDir := fs.String("history-dir", "", "Record every generated policy in this directory, e.g. "+defaultHistoryDir+" (default: no history)")
+	previousFile := fs.String("previous", "", "Policy to compare against for --max-drop-percent (default: the existing --output file)")
+	flagged := pipeline.DefaultSettings()
+	flagged.RegisterGenerateFlags(fs)
+	flagged.RegisterFetchFlags(fs)
+	parseFlags(fs, args)
+	settings := resolveSettings(fs)
+
+	// Log Function
+	ifLog := logger()
+
+	ifLog("IP Filter Tool - Version: %s", version)
+
+	fetcher, err := settings.Fetcher(nil, ifLog)
+	if err != nil {
+		log.Fatalf("Error configuring HTTP client: %v", err)
+	}
+
+	switch *source {
+	case "github":
+		// ---------------------------------------------------------
+		// FETCH, EXTRACT, BUILD AND RE-ORDER THE POLICY
+		// ---------------------------------------------------------
+		// For GitHub, we fetch the meta document (api.github.com/meta, or
+		// /api/v3/meta on GHES) which lists all public IP ranges broken down
+		// by service, keep the IPv4 ranges of the selected keys and wrap them
+		// in a deny policy ordered Version -> Id -> Statement.
+		// In offline mode the document comes from --input-file instead.
+		// ---------------------------------------------------------
+		opts := settings.Options(fetcher)
+
+		// ---------------------------------------------------------
+		// PREVIOUS POLICY FOR THE GUARDRAILS
+		// ---------------------------------------------------------
+		// The policy we are about to replace is the yardstick for how
+		// much the allow list may shrink in one go.
+		// ---------------------------------------------------------
+		switch {
+		case *previousFile != "":
+			if opts.Previous, err = os.ReadFile(*previousFile); err != nil {
+				log.Fatalf("Error reading previous policy: %v", err)
+			}
+		case *output != "":
+			if b, err := os.ReadFile(*output); err == nil {
+				opts.Previous = b
+			}
+		}
+		if *inputFile != "" {
+			ifLog("Reading meta document from %s (offline)...", *inputFile)
+			if opts.Input, err = readInput(*inputFile); err != nil {
+				log.Fatalf("Error reading input: %v", err)
+			}
+		} else {
+			ifLog("Fetching IP ranges from GitHub...")
+		}
+
+		result, err := ipfilter.Generate(context.Background(), opts)
+		if err != nil {
+			log.Fatalf("Error generating policy: %v", err)
+		}
+		for _, warning := range result.Warnings {
+			log.Printf("WARNING (--force): %s", warning)
+		}
+		if *check {
+			os.Exit(checkPolicy(result, *output, ifLog))
+		}
+		final := result.Policy
+
+		// With a cache, an unchanged upstream document usually rebuilds the
+		// policy already on disk. It is only kept when it is byte for byte
+		// what this run built, so new keys, runner ranges or a previous
+		// failed run still produce a fresh policy.
+		if result.NotModified && *output != "" {
+			if current, err := os.ReadFile(*output); err == nil && bytes.Equal(current, final) {
+				ifLog("Upstream metadata unchanged (checked %s); %s is up to date", result.FetchedAt.Format(time.RFC3339), *output)
+				ifLog("Time taken: %s", time.Since(startTime))
+				return
+			}
+		}
+
+		// ---------------------------------------------------------
+		// RECORD HISTORY
+		// ---------------------------------------------------------
+		// With --history-dir, every generated policy is kept with the meta
+		// digest, keys and CIDR count it came from, for `ipfilter history`.
+		// The history is a convenience, so failing to record it does not
+		// stop the policy from being written.
+		// ---------------------------------------------------------
+		if *historyDir != "" {
+			rec := ipfilter.NewHistoryRecord(result, time.Now())
+			history := ipfilter.NewHistory(ipfilter.DirStore{Dir: *historyDir})
+			if err := history.Save(context.Background(), rec, final); err != nil {
+				log.Printf("WARNING: could not record policy history: %v", err)
+			} else {
+				ifLog("Recorded policy %s in %s", rec.ID, *historyDir)
+			}
+		}
+
+		ifLog("Writing policy to %s", *output)
+
+		// ---------------------------------------------------------
+		// WRITE OUTPUT
+		// ---------------------------------------------------------
+		// If --output is not provided, print to stdout.
+		// Otherwise write to the specified file.
+		// ---------------------------------------------------------
+		if *output == "" {
+			fmt.Println(string(final))
+		} else {
+			if err := os.WriteFile(*output, final, 0644); err != nil {
+				log.Fatalf("failed writing file: %v", err)
+			}
+			ifLog("Policy written to %s", *output)
+		}
+		ifLog("Time taken: %s", time.Since(startTime))
+
+	default:
+		log.Fatalf("Unsupported source provider: %s", *source)
+	}
+
+}
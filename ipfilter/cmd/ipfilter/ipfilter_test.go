@@ -0,0 +1,43 @@
+package main
+
+import (
+	ipfilter "ipfilter/ipfilter/filter"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDummy(t *testing.T) {}
+
+func TestCheckPolicy(t *testing.T) {
+	quiet := func(string, ...any) {}
+	build := func(cidrs ...string) []byte {
+		policy, err := ipfilter.BuildDenyPolicy(cidrs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return policy
+	}
+	output := filepath.Join(t.TempDir(), "policy.json")
+	result := &ipfilter.Result{Policy: build("4.148.0.0/16"), NotModified: true}
+
+	if code := checkPolicy(result, output, quiet); code != exitChanged {
+		t.Errorf("Expected exit %d for a missing file, but got %d", exitChanged, code)
+	}
+	// A 304 upstream says nothing about the file: it is still compared.
+	if err := os.WriteFile(output, build("192.30.252.0/22"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := checkPolicy(result, output, quiet); code != exitChanged {
+		t.Errorf("Expected exit %d for a stale file, but got %d", exitChanged, code)
+	}
+	if err := os.WriteFile(output, result.Policy, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := checkPolicy(result, output, quiet); code != exitUnchanged {
+		t.Errorf("Expected exit %d for a current file, but got %d", exitUnchanged, code)
+	}
+	if code := checkPolicy(result, "", quiet); code != exitError {
+		t.Errorf("Expected exit %d without an output file, but got %d", exitError, code)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// defaultJournalDir is where apply keeps its run journals.
+const defaultJournalDir = ".ipfilter-journal"
+
+// runRollback restores the repository policies recorded in the journal of
+// an earlier apply run.
+//
+//	ipfilter rollback --run-id 20240501T120000Z-1a2b3c
+func runRollback(args []string) {
+	fs := newFlagSet("rollback")
+	runID := fs.String("run-id", "", "Run ID printed by apply")
+	journalDir := fs.String("journal-dir", defaultJournalDir, "Directory holding the run journals")
+	region := fs.String("region", "", "AWS region (default: the region recorded in the journal, else from the AWS environment)")
+	format := fs.String("format", "text", "Report format: text or json")
+	parseFlags(fs, args)
+
+	ifLog := logger()
+	ctx := context.Background()
+
+	if *runID == "" {
+		log.Fatalf("Error: --run-id is required")
+	}
+	journal, err := ipfilter.LoadJournal(*journalDir, *runID)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *region == "" {
+		*region = journal.Region
+	}
+	client, err := pipeline.NewECRClient(ctx, *region)
+	if err != nil {
+		log.Fatalf("Error configuring AWS: %v", err)
+	}
+
+	report, err := ipfilter.Rollback(ctx, client, journal, ifLog)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	report.RunID = journal.RunID
+	if err := printReport(report, *format); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(1)
+	}
+}
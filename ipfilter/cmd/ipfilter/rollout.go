@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// runRollout applies a policy across the accounts and regions of a rollout
+// config and prints one consolidated report.
+//
+//	ipfilter rollout --targets rollout.json --policy policy.json [--dry-run]
+func runRollout(args []string) {
+	fs := newFlagSet("rollout")
+	policyFile := fs.String("policy", "policy.json", "Policy document to roll out; '-' reads stdin")
+	concurrency := fs.Int("concurrency", 0, "Account/region targets updated at once (default: the config's, else 4)")
+	dryRun := fs.Bool("dry-run", false, "Show what would be applied without changing any repository")
+	format := fs.String("format", "text", "Report format: text or json")
+	flagged := pipeline.DefaultSettings()
+	fs.IntVar(&flagged.MinCIDRs, "min-cidrs", flagged.MinCIDRs, "Refuse policies with fewer allowed CIDRs than this (an empty list is always refused)")
+	fs.BoolVar(&flagged.Force, "force", flagged.Force, "Roll out the policy even if it fails validation or --min-cidrs")
+	flagged.RegisterRolloutFlags(fs)
+	parseFlags(fs, args)
+	settings := resolveSettings(fs)
+
+	ifLog := logger()
+	ctx := context.Background()
+
+	data, err := os.ReadFile(settings.Targets)
+	if err != nil {
+		log.Fatalf("Error reading rollout config: %v", err)
+	}
+	cfg, err := ipfilter.ParseRolloutConfig(data)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *concurrency > 0 {
+		cfg.Concurrency = *concurrency
+	}
+	policy, err := readInput(*policyFile)
+	if err != nil {
+		log.Fatalf("Error reading policy: %v", err)
+	}
+
+	ifLog("Rolling out to %d account/region targets", len(cfg.Targets()))
+	report, err := ipfilter.Rollout(ctx, pipeline.ECRClientFactory, policy, cfg, ipfilter.RolloutOptions{
+		DryRun:     *dryRun,
+		Guardrails: ipfilter.Guardrails{MinCIDRs: settings.MinCIDRs, Force: settings.Force},
+		Logf:       ifLog,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Error encoding report: %v", err)
+		}
+		fmt.Println(string(b))
+	case "text":
+		fmt.Printf("Policy sha256 %s\n", report.PolicySHA256)
+		for _, t := range report.Targets {
+			if t.Error != "" {
+				fmt.Printf("%-8s %s/%s: %s\n", ipfilter.StatusFailed, t.Account, t.Region, t.Error)
+				continue
+			}
+			for _, res := range t.Results {
+				if res.Error != "" {
+					fmt.Printf("%-8s %s/%s/%s: %s\n", res.Status, t.Account, t.Region, res.Repository, res.Error)
+				} else {
+					fmt.Printf("%-8s %s/%s/%s sha256 %.12s\n", res.Status, t.Account, t.Region, res.Repository, res.PolicySHA256)
+				}
+			}
+		}
+	default:
+		log.Fatalf("Unsupported format: %s", *format)
+	}
+	if err := report.Err(); err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(1)
+	}
+}
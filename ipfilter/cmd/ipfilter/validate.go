@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	ipfilter "ipfilter/ipfilter/filter"
+	"ipfilter/ipfilter/pipeline"
+	"log"
+	"os"
+)
+
+// runValidate checks policy files, e.g. edited by hand or produced by an
+// older release, before they are applied. It exits 0 when every policy is
+// valid and 1 otherwise.
+//
+//	ipfilter validate [--min-cidrs 10] policy.json...
+func runValidate(args []string) {
+	fs := newFlagSet("validate")
+	flagged := pipeline.DefaultSettings()
+	fs.IntVar(&flagged.MinCIDRs, "min-cidrs", flagged.MinCIDRs, "Report policies allowing fewer CIDRs than this")
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		usageError(fs)
+	}
+	settings := resolveSettings(fs)
+
+	ifLog := logger()
+	status := exitUnchanged
+	for _, path := range fs.Args() {
+		b, err := readInput(path)
+		if err != nil {
+			log.Printf("Error reading policy: %v", err)
+			status = exitError
+			continue
+		}
+		problems := ipfilter.ValidatePolicy(b)
+		if len(problems) == 0 {
+			cidrs, _ := ipfilter.PolicySourceIPs(b)
+			var violated *ipfilter.GuardrailError
+			err := (ipfilter.Guardrails{MinCIDRs: settings.MinCIDRs}).Check(cidrs, nil)
+			if errors.As(err, &violated) {
+				problems = append(problems, violated.Violations...)
+			} else if err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if len(problems) == 0 {
+			ifLog("%s is valid", path)
+			continue
+		}
+		status = exitError
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", path, problem)
+		}
+	}
+	os.Exit(status)
+}
@@ -1,5 +0,0 @@
-package main
-
-import "testing"
-
-func TestDummy(t *testing.T) {}
@@ -0,0 +1,9 @@
+package main
+
+import "ipfilter/ipfilter/awslambda"
+
+// A Lambda-only build. The CLI binary serves the same handler when it finds
+// itself in the Lambda runtime, so either can be deployed as bootstrap.
+func main() {
+	awslambda.Start()
+}
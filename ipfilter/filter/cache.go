@@ -0,0 +1,109 @@
+package ipfilter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheEntry is an upstream response remembered for conditional requests.
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"` // last time upstream confirmed Body (200 or 304)
+	Body         []byte    `json:"body"`
+}
+
+// Cache stores CacheEntries by URL. Get returns nil, nil on a miss.
+type Cache interface {
+	Get(url string) (*CacheEntry, error)
+	Put(url string, entry *CacheEntry) error
+}
+
+// DirCache keeps one JSON file per URL in Dir. It suits the CLI, where the
+// cache must outlive the process.
+type DirCache struct {
+	Dir string
+}
+
+func (c DirCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func (c DirCache) Get(url string) (*CacheEntry, error) {
+	b, err := os.ReadFile(c.path(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, err
+	}
+	if entry.URL != url {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// Put writes through a temporary file so a crash never leaves a torn entry.
+func (c DirCache) Put(url string, entry *CacheEntry) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.Dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(url))
+}
+
+// MemoryCache keeps entries in process memory. In Lambda it lives as long
+// as the warm execution environment.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]CacheEntry)}
+}
+
+func (c *MemoryCache) Get(url string) (*CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (c *MemoryCache) Put(url string, entry *CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[url] = *entry
+	return nil
+}
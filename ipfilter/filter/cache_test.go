@@ -0,0 +1,117 @@
+package ipfilter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// etagServer serves body with a fixed ETag and honours If-None-Match.
+func etagServer(t *testing.T, body string, hits *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetcherServesCachedBodyOn304(t *testing.T) {
+	for name, cache := range map[string]Cache{
+		"memory": NewMemoryCache(),
+		"dir":    DirCache{Dir: t.TempDir()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var hits int
+			srv := etagServer(t, `{"actions":["4.148.0.0/16"]}`, &hits)
+			f := &Fetcher{Cache: cache}
+
+			first, err := f.Do(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if first.NotModified {
+				t.Errorf("First fetch should not be NotModified")
+			}
+
+			second, err := f.Do(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !second.NotModified {
+				t.Errorf("Second fetch should be NotModified")
+			}
+			if string(second.Body) != string(first.Body) {
+				t.Errorf("Expected cached body %s, but got %s", first.Body, second.Body)
+			}
+			if second.FetchedAt.Before(first.FetchedAt) {
+				t.Errorf("Expected fetch time to move forward on revalidation")
+			}
+			if hits != 2 {
+				t.Errorf("Expected 2 upstream requests, but got %d", hits)
+			}
+		})
+	}
+}
+
+func TestGenerateRebuildsWhenNotModified(t *testing.T) {
+	var hits int
+	srv := etagServer(t, `{"installed_version":"3.12.0","actions":["4.148.0.0/16"],"hooks":["192.30.252.0/22"]}`, &hits)
+	f := &Fetcher{Cache: NewMemoryCache()}
+	opts := Options{Fetcher: f, BaseURL: srv.URL, Keys: []string{"actions"}}
+
+	first, err := Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Policy == nil || len(first.CIDRs) != 1 {
+		t.Fatalf("Expected a policy with one CIDR, but got %+v", first)
+	}
+
+	// The cached body still yields the same policy.
+	second, err := Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !second.NotModified || string(second.Policy) != string(first.Policy) {
+		t.Errorf("Expected the cached document to produce the same policy, but got %+v", second)
+	}
+	if second.MetaSHA256 != first.MetaSHA256 {
+		t.Errorf("Expected meta SHA-256 %s, but got %s", first.MetaSHA256, second.MetaSHA256)
+	}
+
+	// A 304 must not hide a change of keys.
+	opts.Keys = []string{"actions", "hooks"}
+	third, err := Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !third.NotModified || len(third.CIDRs) != 2 {
+		t.Errorf("Expected a rebuilt policy with two CIDRs, but got %+v", third)
+	}
+
+	// Nor a guardrail refusal: the rebuilt policy is checked again.
+	opts.Keys = []string{"actions"}
+	opts.Guardrails = Guardrails{MinCIDRs: 2}
+	if _, err := Generate(context.Background(), opts); err == nil {
+		t.Errorf("Expected the guardrails to refuse the cached document")
+	}
+	if hits != 4 {
+		t.Errorf("Expected 4 upstream requests, but got %d", hits)
+	}
+}
+
+func TestDirCacheMiss(t *testing.T) {
+	entry, err := DirCache{Dir: t.TempDir()}.Get("https://api.github.com/meta")
+	if err != nil || entry != nil {
+		t.Errorf("Expected a clean miss, but got %v, %v", entry, err)
+	}
+}
@@ -0,0 +1,177 @@
+package ipfilter
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// CIDRSet is a set of addresses kept as sorted, non-overlapping ranges, so
+// two lists covering the same addresses compare equal however they are
+// aggregated or ordered.
+type CIDRSet struct {
+	ranges []addrRange
+}
+
+type addrRange struct {
+	from, to netip.Addr
+}
+
+// NewCIDRSet parses CIDRs (bare addresses count as a single address).
+// IPv4-mapped IPv6 addresses are treated as IPv4.
+func NewCIDRSet(cidrs []string) (*CIDRSet, error) {
+	ranges := make([]addrRange, 0, len(cidrs))
+	for _, c := range cidrs {
+		cidr, err := normalizeCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", c, err)
+		}
+		prefix := netip.MustParsePrefix(cidr)
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefix = prefix.Masked()
+		ranges = append(ranges, addrRange{prefix.Addr(), lastAddr(prefix)})
+	}
+	return &CIDRSet{ranges: mergeRanges(ranges)}, nil
+}
+
+// mergeRanges sorts ranges and joins those that overlap or touch.
+func mergeRanges(ranges []addrRange) []addrRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].from.Less(ranges[j].from) })
+	var out []addrRange
+	for _, r := range ranges {
+		if n := len(out); n > 0 && out[n-1].from.BitLen() == r.from.BitLen() {
+			last := &out[n-1]
+			next := last.to.Next()
+			if !next.IsValid() || !next.Less(r.from) {
+				if last.to.Less(r.to) {
+					last.to = r.to
+				}
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Equal reports whether both sets cover exactly the same addresses.
+func (s *CIDRSet) Equal(other *CIDRSet) bool {
+	if len(s.ranges) != len(other.ranges) {
+		return false
+	}
+	for i := range s.ranges {
+		if s.ranges[i] != other.ranges[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Subtract returns the addresses in s that are not in other.
+func (s *CIDRSet) Subtract(other *CIDRSet) *CIDRSet {
+	var out []addrRange
+	for _, r := range s.ranges {
+		pieces := []addrRange{r}
+		for _, o := range other.ranges {
+			var next []addrRange
+			for _, p := range pieces {
+				next = append(next, cutRange(p, o)...)
+			}
+			pieces = next
+		}
+		out = append(out, pieces...)
+	}
+	return &CIDRSet{ranges: out}
+}
+
+// cutRange removes o from r, leaving zero, one or two pieces.
+func cutRange(r, o addrRange) []addrRange {
+	if r.from.BitLen() != o.from.BitLen() || o.to.Less(r.from) || r.to.Less(o.from) {
+		return []addrRange{r}
+	}
+	var out []addrRange
+	if r.from.Less(o.from) {
+		out = append(out, addrRange{r.from, o.from.Prev()})
+	}
+	if o.to.Less(r.to) {
+		out = append(out, addrRange{o.to.Next(), r.to})
+	}
+	return out
+}
+
+// Prefixes returns the fewest CIDRs that cover the set, in address order.
+func (s *CIDRSet) Prefixes() []netip.Prefix {
+	var out []netip.Prefix
+	for _, r := range s.ranges {
+		from := r.from
+		for {
+			// Widest prefix that starts at from and ends no later than r.to.
+			bits := from.BitLen()
+			for b := 0; b <= from.BitLen(); b++ {
+				p := netip.PrefixFrom(from, b).Masked()
+				if p.Addr() == from && !r.to.Less(lastAddr(p)) {
+					bits = b
+					break
+				}
+			}
+			p := netip.PrefixFrom(from, bits)
+			out = append(out, p)
+			last := lastAddr(p)
+			if last == r.to {
+				break
+			}
+			from = last.Next()
+		}
+	}
+	return out
+}
+
+// Strings is Prefixes formatted as CIDR strings.
+func (s *CIDRSet) Strings() []string {
+	prefixes := s.Prefixes()
+	out := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.String()
+	}
+	return out
+}
+
+// Size returns the number of addresses in the set.
+func (s *CIDRSet) Size() *big.Int {
+	total := new(big.Int)
+	for _, r := range s.ranges {
+		n := new(big.Int).Sub(addrInt(r.to), addrInt(r.from))
+		total.Add(total, n.Add(n, big.NewInt(1)))
+	}
+	return total
+}
+
+// lastAddr returns the highest address in p.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func addrInt(a netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(a.AsSlice())
+}
+
+// MatchCIDR returns the first of cidrs that contains ip. IPv4-mapped IPv6
+// addresses match their IPv4 ranges; invalid entries are skipped.
+func MatchCIDR(cidrs []string, ip netip.Addr) (string, bool) {
+	ip = ip.Unmap()
+	for _, c := range cidrs {
+		prefix, err := netip.ParsePrefix(c)
+		if err == nil && prefix.Contains(ip) {
+			return c, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,201 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ParsePolicy decodes a policy document generated by BuildDenyPolicy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	return &p, nil
+}
+
+// SourceIPs returns the allowed ranges of the deny statement.
+func (p *Policy) SourceIPs() ([]string, error) {
+	st, err := findDenyStatement(p)
+	if err != nil {
+		return nil, err
+	}
+	return st.Condition.NotIpAddress.SourceIPs, nil
+}
+
+// errNoDenyStatement is returned for a policy without DenyStatementSid.
+var errNoDenyStatement = fmt.Errorf("policy has no %q statement", DenyStatementSid)
+
+// findDenyStatement returns the statement carrying DenyStatementSid.
+func findDenyStatement(p *Policy) (Statement, error) {
+	for _, st := range p.Statement {
+		if st.Sid == DenyStatementSid {
+			return st, nil
+		}
+	}
+	return Statement{}, errNoDenyStatement
+}
+
+// PolicyDiff is the semantic difference between the allowed ranges of two
+// policies. Added and Removed are minimal CIDR lists, so re-aggregating or
+// reordering the same ranges produces no diff.
+type PolicyDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+
+	OldCIDRs         int      `json:"old_cidrs"`
+	NewCIDRs         int      `json:"new_cidrs"`
+	OldAddresses     *big.Int `json:"old_addresses"`
+	NewAddresses     *big.Int `json:"new_addresses"`
+	AddedAddresses   *big.Int `json:"added_addresses"`
+	RemovedAddresses *big.Int `json:"removed_addresses"`
+}
+
+// Changed reports whether the policies allow different addresses.
+func (d *PolicyDiff) Changed() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+// AddressDelta is NewAddresses minus OldAddresses.
+func (d *PolicyDiff) AddressDelta() *big.Int {
+	return new(big.Int).Sub(d.NewAddresses, d.OldAddresses)
+}
+
+// DiffPolicies compares the aws:SourceIp sets of two policy documents.
+func DiffPolicies(oldPolicy, newPolicy []byte) (*PolicyDiff, error) {
+	var ips [2][]string
+	for i, doc := range [][]byte{oldPolicy, newPolicy} {
+		p, err := ParsePolicy(doc)
+		if err != nil {
+			return nil, err
+		}
+		if ips[i], err = p.SourceIPs(); err != nil {
+			return nil, err
+		}
+	}
+	return DiffCIDRs(ips[0], ips[1])
+}
+
+// DiffCIDRs compares two lists of CIDRs.
+func DiffCIDRs(oldCIDRs, newCIDRs []string) (*PolicyDiff, error) {
+	oldSet, err := NewCIDRSet(oldCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("old policy: %w", err)
+	}
+	newSet, err := NewCIDRSet(newCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("new policy: %w", err)
+	}
+	added, removed := newSet.Subtract(oldSet), oldSet.Subtract(newSet)
+	return &PolicyDiff{
+		Added:            added.Strings(),
+		Removed:          removed.Strings(),
+		OldCIDRs:         len(oldCIDRs),
+		NewCIDRs:         len(newCIDRs),
+		OldAddresses:     oldSet.Size(),
+		NewAddresses:     newSet.Size(),
+		AddedAddresses:   added.Size(),
+		RemovedAddresses: removed.Size(),
+	}, nil
+}
+
+// PoliciesEquivalent reports whether two policy documents are the same
+// policy: equal apart from formatting and the order and aggregation of
+// their aws:SourceIp ranges.
+func PoliciesEquivalent(a, b []byte) (bool, error) {
+	pa, err := ParsePolicy(a)
+	if err != nil {
+		return false, err
+	}
+	pb, err := ParsePolicy(b)
+	if err != nil {
+		return false, err
+	}
+	if pa.Version != pb.Version || pa.Id != pb.Id || len(pa.Statement) != len(pb.Statement) {
+		return false, nil
+	}
+	for i := range pa.Statement {
+		same, err := statementsEquivalent(pa.Statement[i], pb.Statement[i])
+		if err != nil || !same {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// statementsEquivalent compares two statements field by field, and their
+// aws:SourceIp ranges as address sets.
+func statementsEquivalent(a, b Statement) (bool, error) {
+	if !sameStatementFields(a, b) {
+		return false, nil
+	}
+	diff, err := DiffCIDRs(a.Condition.NotIpAddress.SourceIPs, b.Condition.NotIpAddress.SourceIPs)
+	if err != nil {
+		return false, err
+	}
+	return !diff.Changed(), nil
+}
+
+// sameStatementFields compares everything but the condition.
+func sameStatementFields(a, b Statement) bool {
+	return a.Sid == b.Sid && a.Effect == b.Effect && a.Principal == b.Principal &&
+		a.Action == b.Action && a.Resource == b.Resource
+}
+
+// Text renders the diff for a terminal, one +/- line per CIDR.
+func (d *PolicyDiff) Text() string {
+	var b strings.Builder
+	if !d.Changed() {
+		fmt.Fprintf(&b, "No changes: both policies allow the same %s addresses\n", d.NewAddresses)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "CIDRs: %d -> %d, addresses: %s -> %s (%s)\n",
+		d.OldCIDRs, d.NewCIDRs, d.OldAddresses, d.NewAddresses, signed(d.AddressDelta()))
+	for _, c := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", c)
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", c)
+	}
+	return b.String()
+}
+
+// Markdown renders the diff for a pull request or job summary.
+func (d *PolicyDiff) Markdown() string {
+	var b strings.Builder
+	b.WriteString("### Policy diff\n\n")
+	if !d.Changed() {
+		fmt.Fprintf(&b, "No changes: both policies allow the same %s addresses.\n", d.NewAddresses)
+		return b.String()
+	}
+	b.WriteString("| | CIDRs | Addresses |\n|---|---:|---:|\n")
+	fmt.Fprintf(&b, "| Old | %d | %s |\n", d.OldCIDRs, d.OldAddresses)
+	fmt.Fprintf(&b, "| New | %d | %s |\n", d.NewCIDRs, d.NewAddresses)
+	fmt.Fprintf(&b, "| Delta | %+d | %s |\n", d.NewCIDRs-d.OldCIDRs, signed(d.AddressDelta()))
+	for _, section := range []struct {
+		title string
+		cidrs []string
+		count *big.Int
+	}{
+		{"Added", d.Added, d.AddedAddresses},
+		{"Removed", d.Removed, d.RemovedAddresses},
+	} {
+		if len(section.cidrs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n**%s** (%s addresses)\n\n", section.title, section.count)
+		for _, c := range section.cidrs {
+			fmt.Fprintf(&b, "- `%s`\n", c)
+		}
+	}
+	return b.String()
+}
+
+func signed(n *big.Int) string {
+	if n.Sign() > 0 {
+		return "+" + n.String()
+	}
+	return n.String()
+}
@@ -0,0 +1,94 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCIDRSetNormalisesAggregation(t *testing.T) {
+	a, err := NewCIDRSet([]string{"10.0.0.0/16", "10.1.0.0/17", "10.1.128.0/17", "192.0.2.7"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, _ := NewCIDRSet([]string{"192.0.2.7/32", "10.0.0.0/15", "10.0.5.0/24"})
+	if !a.Equal(b) {
+		t.Errorf("Expected equivalent aggregations to be equal: %v vs %v", a.Strings(), b.Strings())
+	}
+	if want := []string{"10.0.0.0/15", "192.0.2.7/32"}; !reflect.DeepEqual(a.Strings(), want) {
+		t.Errorf("Expected %v, but got %v", want, a.Strings())
+	}
+	if got := a.Size().String(); got != "131073" {
+		t.Errorf("Expected 131073 addresses, but got %s", got)
+	}
+	if _, err := NewCIDRSet([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected an error for an invalid CIDR")
+	}
+}
+
+func TestCIDRSetSubtract(t *testing.T) {
+	a, _ := NewCIDRSet([]string{"10.0.0.0/24"})
+	b, _ := NewCIDRSet([]string{"10.0.0.64/26", "2001:db8::/32"})
+	got := a.Subtract(b).Strings()
+	want := []string{"10.0.0.0/26", "10.0.0.128/25"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+}
+
+func TestDiffPolicies(t *testing.T) {
+	oldPolicy, _ := BuildDenyPolicy([]string{"4.148.0.0/16", "20.1.0.0/16", "13.64.0.0/16"})
+	newPolicy, _ := BuildDenyPolicy([]string{"13.64.0.0/17", "13.64.128.0/17", "4.148.0.0/15"})
+
+	diff, err := DiffPolicies(oldPolicy, newPolicy)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"4.149.0.0/16"}) || !reflect.DeepEqual(diff.Removed, []string{"20.1.0.0/16"}) {
+		t.Fatalf("Unexpected diff: +%v -%v", diff.Added, diff.Removed)
+	}
+	if diff.AddressDelta().Sign() != 0 || diff.AddedAddresses.String() != "65536" {
+		t.Errorf("Expected +65536/-65536 addresses, but got %s added, delta %s", diff.AddedAddresses, diff.AddressDelta())
+	}
+
+	text := diff.Text()
+	if !strings.Contains(text, "+ 4.149.0.0/16") || !strings.Contains(text, "- 20.1.0.0/16") {
+		t.Errorf("Unexpected text diff:\n%s", text)
+	}
+	if md := diff.Markdown(); !strings.Contains(md, "- `4.149.0.0/16`") || !strings.Contains(md, "| Delta | +0 | 0 |") {
+		t.Errorf("Unexpected markdown diff:\n%s", md)
+	}
+	b, _ := json.Marshal(diff)
+	if !strings.Contains(string(b), `"added_addresses":65536`) {
+		t.Errorf("Unexpected JSON diff: %s", b)
+	}
+
+	same, _ := DiffPolicies(newPolicy, newPolicy)
+	if same.Changed() || !strings.HasPrefix(same.Text(), "No changes") {
+		t.Errorf("Expected no changes, but got %s", same.Text())
+	}
+}
+
+func TestPoliciesEquivalent(t *testing.T) {
+	a, _ := BuildDenyPolicy([]string{"4.148.0.0/16", "13.64.0.0/16"})
+	b, _ := ReorderJson([]KV{
+		{"Version", "2012-10-17"},
+		{"Id", PolicyID},
+		{"Statement", []Statement{{
+			Sid: DenyStatementSid, Effect: "Deny", Principal: "*", Action: "ecr:*", Resource: "*",
+			Condition: Condition{NotIpAddress: NotIpAddress{SourceIPs: []string{"13.64.0.0/17", "13.64.128.0/17", "4.148.0.0/16"}}},
+		}}},
+	}, false)
+	c, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+
+	if same, err := PoliciesEquivalent(a, b); err != nil || !same {
+		t.Errorf("Expected reformatted, re-aggregated policies to be equivalent (err %v)", err)
+	}
+	if same, err := PoliciesEquivalent(a, c); err != nil || same {
+		t.Errorf("Expected policies with different ranges to differ (err %v)", err)
+	}
+	if _, err := PoliciesEquivalent(a, []byte("not json")); err == nil {
+		t.Errorf("Expected an error for an unparseable policy")
+	}
+}
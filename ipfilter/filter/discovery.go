@@ -0,0 +1,139 @@
+package ipfilter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// RepositoryFilter selects ECR repositories by name and tags. Every
+// criterion that is set must match; a zero filter selects nothing.
+type RepositoryFilter struct {
+	// Prefixes matches names starting with any of the prefixes.
+	Prefixes []string
+	// Regex matches names against a regular expression (unanchored).
+	Regex string
+	// Tags matches repositories carrying every tag with exactly this value.
+	Tags map[string]string
+}
+
+// Empty reports whether no criterion is set.
+func (f RepositoryFilter) Empty() bool {
+	return len(f.Prefixes) == 0 && f.Regex == "" && len(f.Tags) == 0
+}
+
+// RepositorySelection names the repositories to work on: explicit names plus
+// the criteria of a RepositoryFilter. It is the one JSON schema for
+// repository selection, shared by rollout configs and the CLI and Lambda
+// settings.
+type RepositorySelection struct {
+	Repositories []string          `json:"repositories,omitempty"`
+	Prefixes     []string          `json:"prefixes,omitempty"`
+	Regex        string            `json:"regex,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// Filter returns the discovery criteria of the selection.
+func (s RepositorySelection) Filter() RepositoryFilter {
+	return RepositoryFilter{Prefixes: s.Prefixes, Regex: s.Regex, Tags: s.Tags}
+}
+
+// Empty reports whether the selection names no repository and sets no
+// criterion.
+func (s RepositorySelection) Empty() bool {
+	return len(s.Repositories) == 0 && s.Filter().Empty()
+}
+
+// ParseTags parses "key=value" pairs as given on the command line.
+func ParseTags(pairs []string) (map[string]string, error) {
+	tags := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q: expected key=value", pair)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// DiscoverRepositories lists the repositories in a registry (empty for the
+// caller's) and returns the names matching f, sorted. Tags are only fetched
+// for repositories whose name already matches.
+func DiscoverRepositories(ctx context.Context, client ECRClient, registryID string, f RepositoryFilter) ([]string, error) {
+	if f.Empty() {
+		return nil, nil
+	}
+	var re *regexp.Regexp
+	if f.Regex != "" {
+		var err error
+		if re, err = regexp.Compile(f.Regex); err != nil {
+			return nil, fmt.Errorf("invalid repository regex: %w", err)
+		}
+	}
+
+	in := &ecr.DescribeRepositoriesInput{}
+	if registryID != "" {
+		in.RegistryId = aws.String(registryID)
+	}
+	var names []string
+	pages := ecr.NewDescribeRepositoriesPaginator(client, in)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing repositories: %w", err)
+		}
+		for _, repo := range page.Repositories {
+			name := aws.ToString(repo.RepositoryName)
+			if !hasAnyPrefix(name, f.Prefixes) || re != nil && !re.MatchString(name) {
+				continue
+			}
+			if len(f.Tags) > 0 {
+				ok, err := hasTags(ctx, client, aws.ToString(repo.RepositoryArn), f.Tags)
+				if err != nil {
+					return nil, fmt.Errorf("listing tags of %s: %w", name, err)
+				}
+				if !ok {
+					continue
+				}
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTags(ctx context.Context, client ECRClient, arn string, want map[string]string) (bool, error) {
+	out, err := client.ListTagsForResource(ctx, &ecr.ListTagsForResourceInput{ResourceArn: aws.String(arn)})
+	if err != nil {
+		return false, err
+	}
+	have := make(map[string]string, len(out.Tags))
+	for _, tag := range out.Tags {
+		have[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for k, v := range want {
+		if got, ok := have[k]; !ok || got != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package ipfilter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func discoveryFixture() *fakeECR {
+	f := newFakeECR()
+	f.repos = []string{"team-a/api", "team-a/worker", "team-b/api", "sandbox", "team-a/legacy"}
+	f.tags = map[string]map[string]string{
+		"team-a/api":    {"ci-locked": "true", "owner": "a"},
+		"team-a/worker": {"ci-locked": "false"},
+		"team-b/api":    {"ci-locked": "true"},
+	}
+	return f
+}
+
+func TestDiscoverRepositories(t *testing.T) {
+	cases := map[string]struct {
+		filter RepositoryFilter
+		want   []string
+	}{
+		"prefix":       {RepositoryFilter{Prefixes: []string{"team-a/", "sandbox"}}, []string{"sandbox", "team-a/api", "team-a/legacy", "team-a/worker"}},
+		"regex":        {RepositoryFilter{Regex: `/api$`}, []string{"team-a/api", "team-b/api"}},
+		"tag":          {RepositoryFilter{Tags: map[string]string{"ci-locked": "true"}}, []string{"team-a/api", "team-b/api"}},
+		"all criteria": {RepositoryFilter{Prefixes: []string{"team-a/"}, Regex: "api", Tags: map[string]string{"ci-locked": "true"}}, []string{"team-a/api"}},
+		"no match":     {RepositoryFilter{Prefixes: []string{"nope"}}, nil},
+	}
+	for name, c := range cases {
+		got, err := DiscoverRepositories(context.Background(), discoveryFixture(), "", c.filter)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %v, but got %v", name, c.want, got)
+		}
+	}
+}
+
+func TestDiscoverRepositoriesOnlyFetchesTagsForNameMatches(t *testing.T) {
+	f := discoveryFixture()
+	_, err := DiscoverRepositories(context.Background(), f, "", RepositoryFilter{
+		Prefixes: []string{"team-b/"},
+		Tags:     map[string]string{"ci-locked": "true"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.tagCalls != 1 {
+		t.Errorf("Expected 1 ListTagsForResource call, but got %d", f.tagCalls)
+	}
+	if _, err := DiscoverRepositories(context.Background(), f, "", RepositoryFilter{Regex: "("}); err == nil {
+		t.Errorf("Expected an error for an invalid regex")
+	}
+}
+
+func TestApplyPolicyToDiscoveredRepositories(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	f := discoveryFixture()
+	report, err := ApplyPolicy(context.Background(), f, policy, ApplyOptions{
+		Repositories: []string{"sandbox", "team-b/api"},
+		Filter:       RepositoryFilter{Tags: map[string]string{"ci-locked": "true"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, res := range report.Results {
+		got = append(got, res.Repository)
+	}
+	if want := []string{"sandbox", "team-b/api", "team-a/api"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags([]string{"ci-locked=true", "owner="})
+	if err != nil || tags["ci-locked"] != "true" || tags["owner"] != "" || len(tags) != 2 {
+		t.Errorf("Unexpected tags %v (err %v)", tags, err)
+	}
+	if _, err := ParseTags([]string{"novalue"}); err == nil {
+		t.Errorf("Expected an error for a tag without '='")
+	}
+}
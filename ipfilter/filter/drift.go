@@ -0,0 +1,163 @@
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// Per-repository outcomes of DetectDrift.
+const (
+	DriftCompliant = "compliant"
+	DriftDrifted   = "drifted"
+	DriftMissing   = "missing"
+	DriftError     = "error"
+)
+
+// DriftOptions controls DetectDrift. Repository selection works as for
+// ApplyOptions.
+type DriftOptions struct {
+	Repositories []string
+	Filter       RepositoryFilter
+	RegistryID   string
+	// Merge compares only our deny statement, for repositories whose
+	// policies were applied with ApplyOptions.Merge. Otherwise the whole
+	// document must match.
+	Merge bool
+	Logf  func(string, ...any)
+}
+
+// DriftResult is the state of one repository.
+type DriftResult struct {
+	Repository string `json:"repository"`
+	Status     string `json:"status"`
+	// Detail says what differs, when it is not (only) the allowed ranges.
+	Detail string `json:"detail,omitempty"`
+	// Added and Removed are ranges the deployed policy allows beyond, or
+	// lacks from, the expected one.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// DriftReport lists every checked repository.
+type DriftReport struct {
+	ExpectedSHA256 string        `json:"expected_sha256"`
+	Results        []DriftResult `json:"results"`
+}
+
+// Count returns how many repositories have the given status.
+func (r *DriftReport) Count(status string) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Drifted reports whether any repository is drifted or missing its policy.
+func (r *DriftReport) Drifted() bool {
+	return r.Count(DriftDrifted)+r.Count(DriftMissing) > 0
+}
+
+// DetectDrift reads the deployed policy of every selected repository and
+// compares it semantically with expected, typically freshly generated.
+func DetectDrift(ctx context.Context, client ECRClient, expected []byte, opts DriftOptions) (*DriftReport, error) {
+	want, err := ParsePolicy(expected)
+	if err != nil {
+		return nil, fmt.Errorf("expected policy: %w", err)
+	}
+	wantDeny, err := findDenyStatement(want)
+	if err != nil {
+		return nil, fmt.Errorf("expected policy: %w", err)
+	}
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	repos, err := resolveRepositories(ctx, client, opts.RegistryID, opts.Repositories, opts.Filter, logf)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{ExpectedSHA256: PolicySHA256(expected)}
+	for _, repo := range repos {
+		res := DriftResult{Repository: repo}
+		in := &ecr.GetRepositoryPolicyInput{RepositoryName: aws.String(repo)}
+		if opts.RegistryID != "" {
+			in.RegistryId = aws.String(opts.RegistryID)
+		}
+		out, err := client.GetRepositoryPolicy(ctx, in)
+		var notFound *types.RepositoryPolicyNotFoundException
+		switch {
+		case errors.As(err, &notFound):
+			res.Status, res.Detail = DriftMissing, "repository has no policy"
+		case err != nil:
+			res.Status, res.Detail = DriftError, err.Error()
+		default:
+			compareDeployed(&res, []byte(aws.ToString(out.PolicyText)), want, wantDeny, opts.Merge)
+		}
+		logf("%s: %s", repo, res.Status)
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+// compareDeployed fills in res for a deployed policy document.
+func compareDeployed(res *DriftResult, deployed []byte, want *Policy, wantDeny Statement, merge bool) {
+	drifted := func(detail string) {
+		res.Status, res.Detail = DriftDrifted, detail
+	}
+
+	var got Statement
+	if merge {
+		raw, err := denyStatement(deployed)
+		switch {
+		case errors.Is(err, errNoDenyStatement):
+			res.Status, res.Detail = DriftMissing, err.Error()
+			return
+		case err != nil:
+			drifted(fmt.Sprintf("policy was replaced or edited: %v", err))
+			return
+		}
+		if err := json.Unmarshal(raw, &got); err != nil {
+			drifted(fmt.Sprintf("deny statement was edited beyond recognition: %v", err))
+			return
+		}
+	} else {
+		p, err := ParsePolicy(deployed)
+		if err != nil {
+			drifted(fmt.Sprintf("policy was replaced or edited: %v", err))
+			return
+		}
+		if p.Version != want.Version || p.Id != want.Id || len(p.Statement) != len(want.Statement) {
+			drifted("policy was replaced or has extra statements")
+			return
+		}
+		if got, err = findDenyStatement(p); err != nil {
+			res.Status, res.Detail = DriftMissing, err.Error()
+			return
+		}
+	}
+
+	diff, err := DiffCIDRs(wantDeny.Condition.NotIpAddress.SourceIPs, got.Condition.NotIpAddress.SourceIPs)
+	if err != nil {
+		drifted(err.Error())
+		return
+	}
+	res.Added, res.Removed = diff.Added, diff.Removed
+	switch {
+	case !sameStatementFields(got, wantDeny):
+		drifted("deny statement fields were edited")
+	case diff.Changed():
+		drifted("")
+	default:
+		res.Status = DriftCompliant
+	}
+}
@@ -0,0 +1,74 @@
+package ipfilter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectDrift(t *testing.T) {
+	expected, _ := BuildDenyPolicy([]string{"4.148.0.0/16", "13.64.0.0/16"})
+	reaggregated, _ := BuildDenyPolicy([]string{"13.64.0.0/17", "13.64.128.0/17", "4.148.0.0/16"})
+	widened, _ := BuildDenyPolicy([]string{"4.148.0.0/16", "13.64.0.0/16", "198.51.100.0/24"})
+
+	client := newFakeECR()
+	client.policies["compliant"] = string(reaggregated)
+	client.policies["widened"] = string(widened)
+	client.policies["replaced"] = crossAccountPolicy
+	client.policies["edited"] = strings.Replace(string(expected), `"ecr:*"`, `"ecr:BatchGetImage"`, 1)
+
+	report, err := DetectDrift(context.Background(), client, expected, DriftOptions{
+		Repositories: []string{"compliant", "widened", "replaced", "edited", "bare"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"compliant": DriftCompliant,
+		"widened":   DriftDrifted,
+		"replaced":  DriftDrifted,
+		"edited":    DriftDrifted,
+		"bare":      DriftMissing,
+	}
+	for _, res := range report.Results {
+		if res.Status != want[res.Repository] {
+			t.Errorf("Expected %s for %s, but got %s (%s)", want[res.Repository], res.Repository, res.Status, res.Detail)
+		}
+		if res.Repository == "widened" && !reflect.DeepEqual(res.Added, []string{"198.51.100.0/24"}) {
+			t.Errorf("Expected widened to report the added range, but got %+v", res)
+		}
+	}
+	if !report.Drifted() || report.Count(DriftDrifted) != 3 {
+		t.Errorf("Expected 3 drifted repositories, but got %d", report.Count(DriftDrifted))
+	}
+}
+
+func TestDetectDriftMergeMode(t *testing.T) {
+	expected, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	merged, _, _ := MergePolicy([]byte(crossAccountPolicy), expected)
+
+	client := newFakeECR()
+	client.policies["shared"] = string(merged)
+	client.policies["foreign"] = crossAccountPolicy
+	client.policies["garbled"] = `{"Statement": "not a list"`
+
+	report, err := DetectDrift(context.Background(), client, expected, DriftOptions{
+		Repositories: []string{"shared", "foreign", "garbled"},
+		Merge:        true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Results[0].Status != DriftCompliant || report.Results[1].Status != DriftMissing {
+		t.Errorf("Unexpected merge-mode results: %+v", report.Results)
+	}
+	if report.Results[2].Status != DriftDrifted {
+		t.Errorf("Expected an unparseable policy to count as drift, but got %s", report.Results[2].Status)
+	}
+
+	report, _ = DetectDrift(context.Background(), client, expected, DriftOptions{Repositories: []string{"shared"}})
+	if report.Results[0].Status != DriftDrifted {
+		t.Errorf("Expected extra statements to count as drift outside merge mode, but got %s", report.Results[0].Status)
+	}
+}
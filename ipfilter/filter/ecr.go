@@ -0,0 +1,323 @@
+package ipfilter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// ECRClient is the part of the ECR API the tool uses. *ecr.Client satisfies
+// it; tests substitute a fake.
+type ECRClient interface {
+	DeleteRepositoryPolicy(ctx context.Context, in *ecr.DeleteRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.DeleteRepositoryPolicyOutput, error)
+	DescribeRepositories(ctx context.Context, in *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error)
+	ListTagsForResource(ctx context.Context, in *ecr.ListTagsForResourceInput, optFns ...func(*ecr.Options)) (*ecr.ListTagsForResourceOutput, error)
+	GetRepositoryPolicy(ctx context.Context, in *ecr.GetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.GetRepositoryPolicyOutput, error)
+	SetRepositoryPolicy(ctx context.Context, in *ecr.SetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.SetRepositoryPolicyOutput, error)
+}
+
+// ErrNoRepositories is returned by ApplyPolicy when neither the list nor the
+// filter yields a repository.
+var ErrNoRepositories = errors.New("no repositories to apply the policy to")
+
+// ApplyOptions controls ApplyPolicy.
+type ApplyOptions struct {
+	// Repositories are the ECR repository names to update.
+	Repositories []string
+	// Filter adds every repository it matches (see DiscoverRepositories).
+	Filter RepositoryFilter
+	// RegistryID is the registry (account) owning the repositories; empty
+	// means the caller's default registry.
+	RegistryID string
+	// DryRun reports what would be applied without changing anything. In
+	// merge mode the current policies are still read.
+	DryRun bool
+	// Merge keeps each repository's existing statements and only replaces or
+	// inserts our deny statement (see MergePolicy), instead of overwriting
+	// the whole document.
+	Merge bool
+	// Journal, when set, records each repository's policy before it is
+	// changed so the run can be rolled back later (see Rollback).
+	Journal *Journal
+	// RollbackOnFailure restores every changed repository when any
+	// repository fails. Without a Journal an in-memory one is used.
+	RollbackOnFailure bool
+	// Guardrails are checked before any repository is changed, along with
+	// ValidatePolicy. Only MinCIDRs applies: there is no previous policy to
+	// measure a drop against. Guardrails.Force turns problems into logged
+	// warnings.
+	Guardrails Guardrails
+	// Logf, when set, logs each repository as it is processed.
+	Logf func(string, ...any)
+
+	// policyChecked skips ValidatePolicy and the Guardrails, for Rollout,
+	// which checks the policy once for every target.
+	policyChecked bool
+}
+
+// Per-repository outcomes of ApplyPolicy.
+const (
+	StatusApplied = "applied"
+	StatusDryRun  = "dry-run"
+	StatusFailed  = "failed"
+)
+
+// RepositoryResult is the outcome for one repository.
+type RepositoryResult struct {
+	Repository string `json:"repository"`
+	Status     string `json:"status"`
+	// PolicySHA256 is the digest of the document sent to this repository;
+	// in merge mode it differs from the report's.
+	PolicySHA256 string `json:"policy_sha256,omitempty"`
+	// Statement is StatementReplaced or StatementInserted in merge mode.
+	Statement string `json:"statement,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ApplyReport summarises an ApplyPolicy run.
+type ApplyReport struct {
+	PolicySHA256 string `json:"policy_sha256"`
+	DryRun       bool   `json:"dry_run,omitempty"`
+	// RunID identifies the journal of the run, if it was journaled.
+	RunID string `json:"run_id,omitempty"`
+	// RolledBack is set when a failure triggered RollbackOnFailure.
+	RolledBack bool               `json:"rolled_back,omitempty"`
+	Results    []RepositoryResult `json:"results"`
+}
+
+// Failed returns the number of repositories that could not be updated.
+func (r *ApplyReport) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an error naming the failed repositories, or nil.
+func (r *ApplyReport) Err() error {
+	var errs []error
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			errs = append(errs, fmt.Errorf("%s: %s", res.Repository, res.Error))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d repositories failed: %w", len(errs), len(r.Results), errors.Join(errs...))
+}
+
+// PolicySHA256 returns the hex SHA-256 of a policy document exactly as sent
+// to ECR, so reports can show which version each repository received.
+func PolicySHA256(policy []byte) string {
+	sum := sha256.Sum256(policy)
+	return hex.EncodeToString(sum[:])
+}
+
+// ApplyPolicy sets policy on every repository in opts. A failing repository
+// does not stop the others; check the report's Err. The returned error is
+// reserved for problems that prevent the run altogether.
+func ApplyPolicy(ctx context.Context, client ECRClient, policy []byte, opts ApplyOptions) (*ApplyReport, error) {
+	if _, err := ParsePolicy(policy); err != nil {
+		return nil, err
+	}
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	if !opts.policyChecked {
+		if err := checkApplyPolicy(policy, opts.Guardrails, logf); err != nil {
+			return nil, err
+		}
+	}
+
+	repos, err := resolveRepositories(ctx, client, opts.RegistryID, opts.Repositories, opts.Filter, logf)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ApplyReport{PolicySHA256: PolicySHA256(policy), DryRun: opts.DryRun}
+	if opts.RollbackOnFailure && opts.Journal == nil && !opts.DryRun {
+		opts.Journal = NewJournal("")
+	}
+	if j := opts.Journal; j != nil && !opts.DryRun {
+		if err := j.update(func() {
+			j.PolicySHA256, j.RegistryID = report.PolicySHA256, opts.RegistryID
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, repo := range repos {
+		res := applyOne(ctx, client, policy, repo, opts)
+		switch res.Status {
+		case StatusDryRun:
+			logf("[dry-run] would set policy %.12s on %s", res.PolicySHA256, repo)
+		case StatusApplied:
+			logf("Set policy %.12s on %s", res.PolicySHA256, repo)
+		default:
+			logf("Failed to set policy on %s: %s", repo, res.Error)
+		}
+		report.Results = append(report.Results, res)
+	}
+	if j := opts.Journal; j != nil && j.Path() != "" && len(j.Entries) > 0 {
+		report.RunID = j.RunID
+	}
+
+	if opts.RollbackOnFailure && report.Failed() > 0 && opts.Journal != nil && !opts.DryRun {
+		logf("%d repositories failed; rolling back", report.Failed())
+		rb, err := Rollback(ctx, client, opts.Journal, logf)
+		if err != nil {
+			return report, err
+		}
+		report.RolledBack = true
+		restored := map[string]bool{}
+		for _, r := range rb.Results {
+			restored[r.Repository] = r.Status == StatusRolledBack
+		}
+		for i, res := range report.Results {
+			if res.Status == StatusApplied && restored[res.Repository] {
+				report.Results[i].Status = StatusRolledBack
+			}
+		}
+	}
+	return report, nil
+}
+
+// checkApplyPolicy refuses a policy that ValidatePolicy or the guardrails
+// reject, e.g. a hand-edited file or one left behind by a failed run, unless
+// g.Force is set.
+func checkApplyPolicy(policy []byte, g Guardrails, logf func(string, ...any)) error {
+	problems := ValidatePolicy(policy)
+	if len(problems) == 0 {
+		cidrs, _ := PolicySourceIPs(policy)
+		var violated *GuardrailError
+		if err := g.Check(cidrs, nil); errors.As(err, &violated) {
+			problems = violated.Violations
+		} else if err != nil {
+			problems = []string{err.Error()}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if !g.Force {
+		return fmt.Errorf("refusing to apply policy: %s (force to override)", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		logf("WARNING (force): %s", problem)
+	}
+	return nil
+}
+
+func applyOne(ctx context.Context, client ECRClient, policy []byte, repo string, opts ApplyOptions) RepositoryResult {
+	res := RepositoryResult{Repository: repo}
+	fail := func(err error) RepositoryResult {
+		res.Status, res.Error = StatusFailed, err.Error()
+		return res
+	}
+	var registryID *string
+	if opts.RegistryID != "" {
+		registryID = aws.String(opts.RegistryID)
+	}
+	journal := opts.Journal
+	if opts.DryRun {
+		journal = nil
+	}
+
+	if opts.Merge || journal != nil {
+		out, err := client.GetRepositoryPolicy(ctx, &ecr.GetRepositoryPolicyInput{
+			RepositoryName: aws.String(repo),
+			RegistryId:     registryID,
+		})
+		entry := JournalEntry{Repository: repo}
+		var notFound *types.RepositoryPolicyNotFoundException
+		switch {
+		case errors.As(err, &notFound):
+		case err != nil:
+			return fail(fmt.Errorf("reading current policy: %w", err))
+		default:
+			entry.HadPolicy, entry.PreviousPolicy = true, aws.ToString(out.PolicyText)
+		}
+
+		if opts.Merge {
+			res.Statement = StatementInserted
+			if entry.HadPolicy {
+				if policy, res.Statement, err = MergePolicy([]byte(entry.PreviousPolicy), policy); err != nil {
+					return fail(err)
+				}
+			}
+		}
+		// Journal before writing: after a crash the entry may exist for a
+		// change that never landed, which rolling back tolerates.
+		if journal != nil {
+			if err := journal.record(entry); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	res.PolicySHA256 = PolicySHA256(policy)
+
+	if opts.DryRun {
+		res.Status = StatusDryRun
+		return res
+	}
+	_, err := client.SetRepositoryPolicy(ctx, &ecr.SetRepositoryPolicyInput{
+		RepositoryName: aws.String(repo),
+		RegistryId:     registryID,
+		PolicyText:     aws.String(string(policy)),
+	})
+	if journal != nil {
+		if jerr := journal.markApplied(repo, err == nil); jerr != nil && err == nil {
+			err = jerr
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	res.Status = StatusApplied
+	return res
+}
+
+// resolveRepositories combines an explicit list with the repositories that
+// filter discovers, failing with ErrNoRepositories when both are empty.
+func resolveRepositories(ctx context.Context, client ECRClient, registryID string, repos []string, filter RepositoryFilter, logf func(string, ...any)) ([]string, error) {
+	if !filter.Empty() {
+		found, err := DiscoverRepositories(ctx, client, registryID, filter)
+		if err != nil {
+			return nil, err
+		}
+		logf("Discovered %d matching repositories", len(found))
+		repos = mergeNames(repos, found)
+	}
+	if len(repos) == 0 {
+		return nil, ErrNoRepositories
+	}
+	return repos, nil
+}
+
+// mergeNames appends the names in extra that are not already in names.
+func mergeNames(names, extra []string) []string {
+	seen := make(map[string]bool, len(names))
+	out := append([]string(nil), names...)
+	for _, n := range names {
+		seen[n] = true
+	}
+	for _, n := range extra {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
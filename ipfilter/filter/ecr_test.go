@@ -0,0 +1,208 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// fakeECR records policies per repository and fails for names in failFor.
+// repos and tags back DescribeRepositories (two per page) and
+// ListTagsForResource.
+type fakeECR struct {
+	mu       sync.Mutex
+	policies map[string]string
+	failFor  map[string]bool
+	repos    []string
+	tags     map[string]map[string]string
+	tagCalls int
+}
+
+func newFakeECR(failFor ...string) *fakeECR {
+	f := &fakeECR{policies: map[string]string{}, failFor: map[string]bool{}}
+	for _, repo := range failFor {
+		f.failFor[repo] = true
+	}
+	return f
+}
+
+func (f *fakeECR) DescribeRepositories(ctx context.Context, in *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	start, _ := strconv.Atoi(aws.ToString(in.NextToken))
+	end := min(start+2, len(f.repos))
+	out := &ecr.DescribeRepositoriesOutput{}
+	for _, name := range f.repos[start:end] {
+		out.Repositories = append(out.Repositories, types.Repository{
+			RepositoryName: aws.String(name),
+			RepositoryArn:  aws.String("arn:aws:ecr:eu-west-1:123456789012:repository/" + name),
+		})
+	}
+	if end < len(f.repos) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func (f *fakeECR) ListTagsForResource(ctx context.Context, in *ecr.ListTagsForResourceInput, optFns ...func(*ecr.Options)) (*ecr.ListTagsForResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tagCalls++
+	_, name, _ := strings.Cut(aws.ToString(in.ResourceArn), ":repository/")
+	out := &ecr.ListTagsForResourceOutput{}
+	for k, v := range f.tags[name] {
+		out.Tags = append(out.Tags, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out, nil
+}
+
+func (f *fakeECR) GetRepositoryPolicy(ctx context.Context, in *ecr.GetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.GetRepositoryPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy, ok := f.policies[aws.ToString(in.RepositoryName)]
+	if !ok {
+		return nil, &types.RepositoryPolicyNotFoundException{Message: aws.String("no policy")}
+	}
+	return &ecr.GetRepositoryPolicyOutput{RepositoryName: in.RepositoryName, PolicyText: aws.String(policy)}, nil
+}
+
+func (f *fakeECR) DeleteRepositoryPolicy(ctx context.Context, in *ecr.DeleteRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repo := aws.ToString(in.RepositoryName)
+	if _, ok := f.policies[repo]; !ok {
+		return nil, &types.RepositoryPolicyNotFoundException{Message: aws.String("no policy")}
+	}
+	delete(f.policies, repo)
+	return &ecr.DeleteRepositoryPolicyOutput{RepositoryName: in.RepositoryName}, nil
+}
+
+func (f *fakeECR) SetRepositoryPolicy(ctx context.Context, in *ecr.SetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.SetRepositoryPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repo := aws.ToString(in.RepositoryName)
+	if f.failFor[repo] {
+		return nil, errors.New("AccessDeniedException: not authorized")
+	}
+	f.policies[repo] = aws.ToString(in.PolicyText)
+	return &ecr.SetRepositoryPolicyOutput{RepositoryName: in.RepositoryName, PolicyText: in.PolicyText}, nil
+}
+
+func TestApplyPolicyReportsPerRepository(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	client := newFakeECR("locked")
+
+	report, err := ApplyPolicy(context.Background(), client, policy, ApplyOptions{
+		Repositories: []string{"app", "locked", "base-images"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{"app": StatusApplied, "locked": StatusFailed, "base-images": StatusApplied}
+	for _, res := range report.Results {
+		if res.Status != want[res.Repository] {
+			t.Errorf("Expected %s for %s, but got %s", want[res.Repository], res.Repository, res.Status)
+		}
+	}
+	if client.policies["app"] != string(policy) {
+		t.Errorf("Expected app to receive the policy, but got %q", client.policies["app"])
+	}
+	if report.Failed() != 1 || report.Err() == nil || !strings.Contains(report.Err().Error(), "locked") {
+		t.Errorf("Expected one failure naming locked, but got %v", report.Err())
+	}
+	if report.PolicySHA256 != PolicySHA256(policy) {
+		t.Errorf("Expected the policy digest in the report, but got %q", report.PolicySHA256)
+	}
+}
+
+func TestApplyPolicyDryRun(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	client := newFakeECR()
+
+	report, err := ApplyPolicy(context.Background(), client, policy, ApplyOptions{Repositories: []string{"app"}, DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.policies) != 0 {
+		t.Errorf("Expected no ECR calls in dry-run, but got %v", client.policies)
+	}
+	if report.Results[0].Status != StatusDryRun || report.Err() != nil {
+		t.Errorf("Unexpected dry-run report: %+v", report.Results)
+	}
+
+	if _, err := ApplyPolicy(context.Background(), client, policy, ApplyOptions{}); err == nil {
+		t.Errorf("Expected an error without repositories")
+	}
+	if _, err := ApplyPolicy(context.Background(), client, []byte("{"), ApplyOptions{Repositories: []string{"app"}}); err == nil {
+		t.Errorf("Expected an error for an invalid policy")
+	}
+}
+
+func TestApplyPolicyRefusesRejectedPolicy(t *testing.T) {
+	empty, _ := BuildDenyPolicy(nil)
+	small, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	for name, tc := range map[string]struct {
+		policy []byte
+		opts   ApplyOptions
+	}{
+		"empty allow list": {empty, ApplyOptions{}},
+		"below min CIDRs":  {small, ApplyOptions{Guardrails: Guardrails{MinCIDRs: 2}}},
+	} {
+		client := newFakeECR()
+		tc.opts.Repositories = []string{"app"}
+		if _, err := ApplyPolicy(context.Background(), client, tc.policy, tc.opts); err == nil || !strings.Contains(err.Error(), "refusing to apply") {
+			t.Errorf("%s: Expected the policy to be refused, but got %v", name, err)
+		}
+		if len(client.policies) != 0 {
+			t.Errorf("%s: Expected no repository to change, but got %v", name, client.policies)
+		}
+
+		var warnings []string
+		tc.opts.Guardrails.Force = true
+		tc.opts.Logf = func(msg string, args ...any) { warnings = append(warnings, fmt.Sprintf(msg, args...)) }
+		report, err := ApplyPolicy(context.Background(), client, tc.policy, tc.opts)
+		if err != nil || report.Err() != nil {
+			t.Fatalf("%s: Expected force to apply the policy, but got %v", name, err)
+		}
+		if len(warnings) == 0 || !strings.HasPrefix(warnings[0], "WARNING (force)") {
+			t.Errorf("%s: Expected a forced warning, but got %v", name, warnings)
+		}
+	}
+}
+
+func TestApplyPolicyMerge(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	client := newFakeECR()
+	client.policies["shared"] = crossAccountPolicy
+	client.policies["broken"] = `{"Statement": [`
+
+	report, err := ApplyPolicy(context.Background(), client, policy, ApplyOptions{
+		Repositories: []string{"shared", "fresh", "broken"},
+		Merge:        true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	byRepo := map[string]RepositoryResult{}
+	for _, res := range report.Results {
+		byRepo[res.Repository] = res
+	}
+	if r := byRepo["shared"]; r.Status != StatusApplied || r.Statement != StatementInserted {
+		t.Errorf("Unexpected result for shared: %+v", r)
+	}
+	if !strings.Contains(client.policies["shared"], "AllowCrossAccountPull") {
+		t.Errorf("Expected the cross-account statement to survive, but got %s", client.policies["shared"])
+	}
+	if r := byRepo["fresh"]; r.Status != StatusApplied || client.policies["fresh"] != string(policy) {
+		t.Errorf("Expected a repository without a policy to get ours unchanged: %+v", r)
+	}
+	if r := byRepo["broken"]; r.Status != StatusFailed || client.policies["broken"] != `{"Statement": [` {
+		t.Errorf("Expected an unparseable policy to be left alone and reported: %+v", r)
+	}
+}
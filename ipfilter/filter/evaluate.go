@@ -0,0 +1,292 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// EvalRequest is a simulated API call to evaluate a policy against.
+type EvalRequest struct {
+	// Principal is the caller's ARN, e.g. arn:aws:iam::123456789012:role/ci.
+	// Empty only matches a "*" principal.
+	Principal string `json:"principal,omitempty"`
+	Action    string `json:"action"`
+	// Resource is the ARN acted on; statements without a Resource element,
+	// as in repository policies, apply to any.
+	Resource string `json:"resource,omitempty"`
+	// Context holds the condition keys of the request, e.g. aws:SourceIp
+	// or aws:SecureTransport.
+	Context map[string]string `json:"context,omitempty"`
+}
+
+// Decision is the outcome of evaluating a policy.
+type Decision string
+
+const (
+	DecisionAllow        Decision = "Allow"
+	DecisionExplicitDeny Decision = "ExplicitDeny"
+	// DecisionImplicitDeny means no statement allowed the request. Other
+	// policies, such as the caller's identity policy, may still allow it.
+	DecisionImplicitDeny Decision = "ImplicitDeny"
+)
+
+// MatchedStatement is a statement that applied to a request.
+type MatchedStatement struct {
+	Index  int    `json:"index"`
+	Sid    string `json:"sid,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// Evaluation is the decision on a request and the statements behind it.
+type Evaluation struct {
+	Decision Decision           `json:"decision"`
+	Matched  []MatchedStatement `json:"matched"`
+}
+
+// EvaluatePolicy evaluates a policy document for req with IAM's rules: an
+// explicit Deny wins over any Allow, and without an Allow the request is
+// implicitly denied. Only the subset of IAM this tool emits or merges into
+// is supported: Principal, Action/NotAction and Resource/NotResource with
+// wildcards, and the IpAddress, NotIpAddress, StringEquals, ArnLike and Bool
+// condition operators. Anything else is an error rather than a guess.
+func EvaluatePolicy(policy []byte, req EvalRequest) (*Evaluation, error) {
+	var doc struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(policy, &doc); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	statements, err := rawStatements(doc.Statement)
+	if err != nil {
+		return nil, err
+	}
+
+	// Condition keys are case-insensitive in IAM: aws:SourceIp and
+	// aws:sourceip are the same key.
+	context := make(map[string]string, len(req.Context))
+	for key, value := range req.Context {
+		context[strings.ToLower(key)] = value
+	}
+	req.Context = context
+
+	ev := &Evaluation{Decision: DecisionImplicitDeny, Matched: []MatchedStatement{}}
+	for i, raw := range statements {
+		var st iamStatement
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, fmt.Errorf("parsing policy statement %d: %w", i, err)
+		}
+		ok, err := st.matches(req)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d (%s): %w", i, st.Sid, err)
+		}
+		if !ok {
+			continue
+		}
+		ev.Matched = append(ev.Matched, MatchedStatement{Index: i, Sid: st.Sid, Effect: st.Effect})
+		switch {
+		case st.Effect == "Deny":
+			ev.Decision = DecisionExplicitDeny
+		case st.Effect == "Allow" && ev.Decision != DecisionExplicitDeny:
+			ev.Decision = DecisionAllow
+		}
+	}
+	return ev, nil
+}
+
+// iamStatement is a statement in any of the shapes IAM accepts.
+type iamStatement struct {
+	Sid          string                              `json:"Sid"`
+	Effect       string                              `json:"Effect"`
+	Principal    json.RawMessage                     `json:"Principal"`
+	NotPrincipal json.RawMessage                     `json:"NotPrincipal"`
+	Action       stringOrSlice                       `json:"Action"`
+	NotAction    stringOrSlice                       `json:"NotAction"`
+	Resource     stringOrSlice                       `json:"Resource"`
+	NotResource  stringOrSlice                       `json:"NotResource"`
+	Condition    map[string]map[string]stringOrSlice `json:"Condition"`
+}
+
+func (st *iamStatement) matches(req EvalRequest) (bool, error) {
+	if st.Effect != "Allow" && st.Effect != "Deny" {
+		return false, fmt.Errorf("unsupported Effect %q", st.Effect)
+	}
+	if st.NotPrincipal != nil {
+		return false, fmt.Errorf("NotPrincipal is not supported")
+	}
+	if st.Principal != nil {
+		ok, err := principalMatches(st.Principal, req.Principal)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	switch {
+	case st.Action != nil:
+		if !anyMatch(st.Action, req.Action, actionMatch) {
+			return false, nil
+		}
+	case st.NotAction != nil:
+		if anyMatch(st.NotAction, req.Action, actionMatch) {
+			return false, nil
+		}
+	default:
+		return false, fmt.Errorf("statement has neither Action nor NotAction")
+	}
+
+	switch {
+	case st.Resource != nil:
+		if !anyMatch(st.Resource, req.Resource, arnLike) {
+			return false, nil
+		}
+	case st.NotResource != nil:
+		if anyMatch(st.NotResource, req.Resource, arnLike) {
+			return false, nil
+		}
+	}
+
+	// Operators, and keys within an operator, must all hold; any one value
+	// of a key satisfies it. Every condition is evaluated, so an unsupported
+	// operator is reported whatever the map order.
+	holds := true
+	for op, keys := range st.Condition {
+		for key, values := range keys {
+			ok, err := conditionHolds(op, key, values, req.Context)
+			if err != nil {
+				return false, err
+			}
+			holds = holds && ok
+		}
+	}
+	return holds, nil
+}
+
+// principalMatches accepts "*", or {"AWS": ...} and {"Service": ...} maps.
+// An account ID or its :root ARN matches every principal in the account.
+func principalMatches(raw json.RawMessage, principal string) (bool, error) {
+	var star string
+	if json.Unmarshal(raw, &star) == nil {
+		if star != "*" {
+			return false, fmt.Errorf("unsupported Principal %q", star)
+		}
+		return true, nil
+	}
+	var byType map[string]stringOrSlice
+	if err := json.Unmarshal(raw, &byType); err != nil {
+		return false, fmt.Errorf("parsing Principal: %w", err)
+	}
+	for typ, values := range byType {
+		if typ != "AWS" && typ != "Service" {
+			return false, fmt.Errorf("unsupported principal type %q", typ)
+		}
+		for _, v := range values {
+			if v == "*" || v == principal {
+				return true, nil
+			}
+			if typ != "AWS" || principal == "" {
+				continue
+			}
+			account := strings.TrimSuffix(strings.TrimPrefix(v, "arn:aws:iam::"), ":root")
+			if parts := strings.SplitN(principal, ":", 6); len(parts) == 6 && parts[4] == account {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// conditionHolds evaluates one condition key against a context whose keys
+// are in lower case. A key missing from the request fails every operator
+// except the negated NotIpAddress.
+func conditionHolds(op, key string, values []string, context map[string]string) (bool, error) {
+	actual, present := context[strings.ToLower(key)]
+	switch op {
+	case "IpAddress", "NotIpAddress":
+		if !present {
+			return op == "NotIpAddress", nil
+		}
+		ip, err := netip.ParseAddr(actual)
+		if err != nil {
+			return false, fmt.Errorf("request %s %q is not an IP address", key, actual)
+		}
+		var cidrs []string
+		for _, v := range values {
+			cidr, err := normalizeCIDR(v)
+			if err != nil {
+				return false, fmt.Errorf("invalid %s value %q", op, v)
+			}
+			cidrs = append(cidrs, cidr)
+		}
+		_, in := MatchCIDR(cidrs, ip)
+		return in == (op == "IpAddress"), nil
+	case "StringEquals":
+		return present && anyMatch(values, actual, func(p, s string) bool { return p == s }), nil
+	case "ArnLike":
+		return present && anyMatch(values, actual, arnLike), nil
+	case "Bool":
+		return present && anyMatch(values, actual, strings.EqualFold), nil
+	default:
+		return false, fmt.Errorf("unsupported condition operator %q", op)
+	}
+}
+
+func anyMatch(patterns []string, s string, match func(pattern, s string) bool) bool {
+	for _, p := range patterns {
+		if match(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// actionMatch compares actions case-insensitively, with wildcards.
+func actionMatch(pattern, action string) bool {
+	return wildcardMatch(strings.ToLower(pattern), strings.ToLower(action))
+}
+
+// arnLike compares each of the six colon-separated parts of an ARN on its
+// own, so a wildcard never spans parts. "*" matches anything.
+func arnLike(pattern, arn string) bool {
+	if pattern == "*" {
+		return true
+	}
+	p, a := strings.SplitN(pattern, ":", 6), strings.SplitN(arn, ":", 6)
+	if len(p) != 6 || len(a) != 6 {
+		return wildcardMatch(pattern, arn)
+	}
+	for i := range p {
+		if !wildcardMatch(p[i], a[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// wildcardMatch matches s against a pattern where * is any run of
+// characters and ? any single character.
+func wildcardMatch(pattern, s string) bool {
+	// Iterative matching with backtracking to the last *.
+	px, sx := 0, 0
+	star, mark := -1, 0
+	for sx < len(s) {
+		switch {
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == s[sx]):
+			px++
+			sx++
+		case px < len(pattern) && pattern[px] == '*':
+			star, mark = px, sx
+			px++
+		case star >= 0:
+			px = star + 1
+			mark++
+			sx = mark
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
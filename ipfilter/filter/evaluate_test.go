@@ -0,0 +1,172 @@
+package ipfilter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateGeneratedPolicy(t *testing.T) {
+	policy, err := BuildDenyPolicy([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := EvalRequest{
+		Principal: "arn:aws:iam::123456789012:role/ci",
+		Action:    "ecr:BatchGetImage",
+		Resource:  "arn:aws:ecr:eu-west-1:123456789012:repository/app",
+		Context:   map[string]string{"aws:SourceIp": "198.51.100.1"},
+	}
+	ev, err := EvaluatePolicy(policy, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []MatchedStatement{{Index: 0, Sid: DenyStatementSid, Effect: "Deny"}}
+	if ev.Decision != DecisionExplicitDeny || !reflect.DeepEqual(ev.Matched, want) {
+		t.Errorf("Expected an explicit deny by %v, but got %+v", want, ev)
+	}
+
+	// From an allowed range the deny does not apply, and nothing allows.
+	req.Context["aws:SourceIp"] = "192.0.2.10"
+	if ev, err = EvaluatePolicy(policy, req); err != nil || ev.Decision != DecisionImplicitDeny || len(ev.Matched) != 0 {
+		t.Errorf("Expected an implicit deny with no matches, but got %+v (%v)", ev, err)
+	}
+	// Condition keys match whatever their case.
+	req.Context = map[string]string{"AWS:SOURCEIP": "192.0.2.10"}
+	if ev, err = EvaluatePolicy(policy, req); err != nil || ev.Decision != DecisionImplicitDeny {
+		t.Errorf("Expected AWS:SOURCEIP to be read as aws:SourceIp, but got %+v (%v)", ev, err)
+	}
+	lower := []byte(strings.Replace(string(policy), "aws:SourceIp", "aws:sourceip", 1))
+	if ev, err = EvaluatePolicy(lower, req); err != nil || ev.Decision != DecisionImplicitDeny {
+		t.Errorf("Expected a policy's aws:sourceip to match, but got %+v (%v)", ev, err)
+	}
+	// A request without a source IP is outside every range.
+	delete(req.Context, "AWS:SOURCEIP")
+	if ev, err = EvaluatePolicy(policy, req); err != nil || ev.Decision != DecisionExplicitDeny {
+		t.Errorf("Expected a request without aws:SourceIp to be denied, but got %+v (%v)", ev, err)
+	}
+	// The deny only covers ECR.
+	req.Action = "s3:GetObject"
+	if ev, err = EvaluatePolicy(policy, req); err != nil || ev.Decision != DecisionImplicitDeny {
+		t.Errorf("Expected a non-ECR action to be left alone, but got %+v (%v)", ev, err)
+	}
+}
+
+func TestEvaluateMergedPolicy(t *testing.T) {
+	policy := []byte(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Sid": "AllowPull",
+				"Effect": "Allow",
+				"Principal": {"AWS": ["arn:aws:iam::111122223333:root"]},
+				"Action": ["ecr:BatchGet*", "ecr:GetDownloadUrlForLayer"],
+				"Condition": {
+					"ArnLike": {"aws:PrincipalArn": "arn:aws:iam::111122223333:role/ci-*"},
+					"Bool": {"aws:SecureTransport": "true"}
+				}
+			},
+			{
+				"Sid": "DenyOutsideOrg",
+				"Effect": "Deny",
+				"Principal": "*",
+				"NotAction": "ecr:Describe*",
+				"Resource": "arn:aws:ecr:*:111122223333:repository/app",
+				"Condition": {"StringEquals": {"aws:PrincipalOrgID": "o-other"}}
+			},
+			{
+				"Sid": "DenyNonGitHubActionsIPs",
+				"Effect": "Deny",
+				"Principal": "*",
+				"Action": "ecr:*",
+				"Resource": "*",
+				"Condition": {"NotIpAddress": {"aws:SourceIp": ["192.0.2.0/24", "203.0.113.7"]}}
+			}
+		]
+	}`)
+	base := func() EvalRequest {
+		return EvalRequest{
+			Principal: "arn:aws:iam::111122223333:role/ci-build",
+			Action:    "ECR:BatchGetImage",
+			Resource:  "arn:aws:ecr:eu-west-1:111122223333:repository/app",
+			Context: map[string]string{
+				"aws:SourceIp":        "203.0.113.7",
+				"aws:PrincipalArn":    "arn:aws:iam::111122223333:role/ci-build",
+				"aws:SecureTransport": "True",
+				"aws:PrincipalOrgID":  "o-mine",
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*EvalRequest)
+		decision Decision
+		sids     []string
+	}{
+		{"allowed", func(r *EvalRequest) {}, DecisionAllow, []string{"AllowPull"}},
+		{"other principal", func(r *EvalRequest) { r.Principal = "arn:aws:iam::999999999999:role/ci-build" }, DecisionImplicitDeny, nil},
+		{"role outside the ArnLike pattern", func(r *EvalRequest) { r.Context["aws:PrincipalArn"] = "arn:aws:iam::111122223333:role/admin" }, DecisionImplicitDeny, nil},
+		{"plain HTTP", func(r *EvalRequest) { r.Context["aws:SecureTransport"] = "false" }, DecisionImplicitDeny, nil},
+		{"deny beats allow", func(r *EvalRequest) { r.Context["aws:SourceIp"] = "198.51.100.1" }, DecisionExplicitDeny, []string{"AllowPull", "DenyNonGitHubActionsIPs"}},
+		{"NotAction exempts describe", func(r *EvalRequest) {
+			r.Action = "ecr:DescribeImages"
+			r.Context["aws:PrincipalOrgID"] = "o-other"
+		}, DecisionImplicitDeny, nil},
+		{"NotAction covers the rest", func(r *EvalRequest) { r.Context["aws:PrincipalOrgID"] = "o-other" }, DecisionExplicitDeny, []string{"AllowPull", "DenyOutsideOrg"}},
+		{"resource ARN parts", func(r *EvalRequest) {
+			r.Resource = "arn:aws:ecr:eu-west-1:111122223333:repository/app-other"
+			r.Context["aws:PrincipalOrgID"] = "o-other"
+		}, DecisionAllow, []string{"AllowPull"}},
+	}
+	for _, tt := range tests {
+		req := base()
+		tt.modify(&req)
+		ev, err := EvaluatePolicy(policy, req)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		var sids []string
+		for _, m := range ev.Matched {
+			sids = append(sids, m.Sid)
+		}
+		if ev.Decision != tt.decision || !reflect.DeepEqual(sids, tt.sids) {
+			t.Errorf("%s: Expected %s by %v, but got %s by %v", tt.name, tt.decision, tt.sids, ev.Decision, sids)
+		}
+	}
+}
+
+func TestEvaluateRejectsUnsupported(t *testing.T) {
+	for _, policy := range []string{
+		`{"Statement": {"Effect": "Allow", "Action": "*", "Condition": {"DateGreaterThan": {"aws:CurrentTime": "2020-01-01T00:00:00Z"}}}}`,
+		`{"Statement": {"Effect": "Allow", "NotPrincipal": {"AWS": "*"}, "Action": "*"}}`,
+		`{"Statement": {"Effect": "Audit", "Action": "*"}}`,
+		`{"Statement": {"Effect": "Allow"}}`,
+	} {
+		if _, err := EvaluatePolicy([]byte(policy), EvalRequest{Action: "ecr:GetAuthorizationToken"}); err == nil {
+			t.Errorf("Expected %s to be rejected", policy)
+		}
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"ecr:*", "ecr:BatchGetImage", true},
+		{"ecr:Batch?etImage", "ecr:BatchGetImage", true},
+		{"ecr:*Image", "ecr:BatchGetImage", true},
+		{"ecr:*Layer", "ecr:BatchGetImage", false},
+		{"*a*b", "xaxxb", true},
+		{"", "", true},
+		{"a", "", false},
+	} {
+		if got := wildcardMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q): Expected %v, but got %v", tt.pattern, tt.s, tt.want, got)
+		}
+	}
+	if arnLike("arn:aws:ecr:*:111122223333:repository/*", "arn:aws:ecr:eu-west-1:444455556666:repository/111122223333") {
+		t.Errorf("Expected a wildcard not to span ARN parts")
+	}
+}
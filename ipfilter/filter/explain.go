@@ -0,0 +1,101 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RunnerSource is the Provenance source of a RunnerCIDRs range.
+const RunnerSource = "runner_cidrs"
+
+// Provenance maps a CIDR to where it came from: the meta keys listing it,
+// and RunnerSource for an extra runner range.
+type Provenance map[string][]string
+
+// Provenance returns the sources of every range in the document, across
+// all keys and not only the selected ones.
+func (m *Meta) Provenance() Provenance {
+	p := make(Provenance)
+	for key, ranges := range m.Ranges {
+		for _, cidr := range ranges {
+			p.Add(cidr, key)
+		}
+	}
+	return p
+}
+
+// Add records source as an origin of cidr.
+func (p Provenance) Add(cidr, source string) {
+	for _, s := range p[cidr] {
+		if s == source {
+			return
+		}
+	}
+	p[cidr] = append(p[cidr], source)
+	sort.Strings(p[cidr])
+}
+
+// IPExplanation says whether a deny policy lets an address through, and why.
+type IPExplanation struct {
+	IP      string `json:"ip"`
+	Allowed bool   `json:"allowed"`
+	// CIDR is the first allowed range containing IP.
+	CIDR string `json:"cidr,omitempty"`
+	// Sources are where CIDR came from; empty when unknown.
+	Sources []string `json:"sources,omitempty"`
+	// Reason explains the verdict in a sentence.
+	Reason string `json:"reason"`
+}
+
+// ExplainIP evaluates the NotIpAddress condition of a policy's deny
+// statement for a request from ip. The statement denies every address
+// outside its aws:SourceIp ranges, so ip is allowed exactly when one of them
+// contains it. prov, which may be nil, attributes the matching range to the
+// selected keys and RunnerSource, or for a denied address names the meta
+// keys that would have allowed it. keys are the meta keys the policy was
+// built from; nil credits every key in prov.
+func ExplainIP(policy []byte, ip netip.Addr, prov Provenance, keys []string) (*IPExplanation, error) {
+	cidrs, err := PolicySourceIPs(policy)
+	if err != nil {
+		return nil, err
+	}
+	ip = ip.Unmap()
+	e := &IPExplanation{IP: ip.String()}
+	if e.CIDR, e.Allowed = MatchCIDR(cidrs, ip); e.Allowed {
+		for _, source := range prov[e.CIDR] {
+			if keys == nil || source == RunnerSource || slices.Contains(keys, source) {
+				e.Sources = append(e.Sources, source)
+			}
+		}
+		e.Reason = fmt.Sprintf("in allowed range %s", e.CIDR)
+		if len(e.Sources) > 0 {
+			e.Reason += " from " + strings.Join(e.Sources, ", ")
+		}
+		return e, nil
+	}
+
+	switch {
+	case !ip.Is4():
+		e.Reason = "IPv6 addresses are always denied; the policy only allows IPv4 ranges"
+	case len(cidrs) == 0:
+		e.Reason = "the policy allows no ranges, so every address is denied"
+	default:
+		e.Reason = fmt.Sprintf("outside all %d allowed ranges", len(cidrs))
+	}
+	// Point at the meta keys that list the address but were not selected,
+	// or were added upstream after the policy was generated.
+	var listed []string
+	for cidr, sources := range prov {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(ip) {
+			listed = append(listed, fmt.Sprintf("%s (%s)", strings.Join(sources, ", "), cidr))
+		}
+	}
+	if len(listed) > 0 && ip.Is4() {
+		sort.Strings(listed)
+		e.Reason += "; the meta document lists it under " + strings.Join(listed, "; ") + ", which the policy does not include"
+	}
+	return e, nil
+}
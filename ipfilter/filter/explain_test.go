@@ -0,0 +1,67 @@
+package ipfilter
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplainIP(t *testing.T) {
+	meta := []byte(`{
+		"actions": ["192.0.2.0/24", "198.51.100.0/24"],
+		"web": ["198.51.100.0/24"],
+		"hooks": ["203.0.113.0/25", "2001:db8::/32"]
+	}`)
+	res, err := Generate(context.Background(), Options{
+		Input:       meta,
+		Keys:        []string{"actions"},
+		RunnerCIDRs: []string{"10.1.0.0/16"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		ip          string
+		wantAllowed bool
+		wantCIDR    string
+		wantSources []string
+		wantReason  string
+	}{
+		{"198.51.100.7", true, "198.51.100.0/24", []string{"actions"}, "from actions"},
+		{"::ffff:10.1.2.3", true, "10.1.0.0/16", []string{RunnerSource}, "from runner_cidrs"},
+		{"203.0.113.9", false, "", nil, "lists it under hooks (203.0.113.0/25)"},
+		{"203.0.113.200", false, "", nil, "outside all 3 allowed ranges"},
+		{"2001:db8::1", false, "", nil, "IPv6 addresses are always denied"},
+	}
+	for _, tt := range tests {
+		e, err := ExplainIP(res.Policy, netip.MustParseAddr(tt.ip), res.Provenance, res.Keys)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if e.Allowed != tt.wantAllowed || e.CIDR != tt.wantCIDR || !reflect.DeepEqual(e.Sources, tt.wantSources) {
+			t.Errorf("ExplainIP(%s): Expected %v %q %v, but got %+v", tt.ip, tt.wantAllowed, tt.wantCIDR, tt.wantSources, e)
+		}
+		if !strings.Contains(e.Reason, tt.wantReason) {
+			t.Errorf("ExplainIP(%s): Expected the reason to mention %q, but got %q", tt.ip, tt.wantReason, e.Reason)
+		}
+	}
+
+	// web also lists the range but was not selected; without the keys it
+	// is credited too.
+	e, err := ExplainIP(res.Policy, netip.MustParseAddr("198.51.100.7"), res.Provenance, nil)
+	if err != nil || !reflect.DeepEqual(e.Sources, []string{"actions", "web"}) {
+		t.Errorf("Expected sources [actions web] without keys, but got %+v (%v)", e, err)
+	}
+
+	// Without provenance the verdict still holds.
+	e, err = ExplainIP(res.Policy, netip.MustParseAddr("192.0.2.1"), nil, nil)
+	if err != nil || !e.Allowed || e.Sources != nil {
+		t.Errorf("Expected an allowed address without sources, but got %+v (%v)", e, err)
+	}
+	if _, err := ExplainIP([]byte(`{"Statement": []}`), netip.MustParseAddr("192.0.2.1"), nil, nil); err == nil {
+		t.Errorf("Expected a policy without the deny statement to be rejected")
+	}
+}
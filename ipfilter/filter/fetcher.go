@@ -0,0 +1,255 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how often and how patiently a Fetcher retries.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first; <= 1 disables retries
+	BaseDelay   time.Duration // wait before the second attempt, doubled after each failure
+	MaxDelay    time.Duration // upper bound on any single wait, including Retry-After
+	Jitter      float64       // fraction (0..1) of each wait that is randomised
+}
+
+// DefaultRetryPolicy is used by NewFetcher.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
+// backoff returns the jittered exponential delay after the given failed attempt (1-based).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		spread := float64(d) * p.Jitter
+		d += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// retryDelay decides whether err is worth another attempt and, if the server
+// told us how long to wait, returns that wait.
+func retryDelay(err error) (retry bool, wait time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		// Content-type and size errors won't fix themselves; network errors might.
+		var ctErr *ContentTypeError
+		var sizeErr *BodyTooLargeError
+		return !errors.As(err, &ctErr) && !errors.As(err, &sizeErr), 0
+	}
+	switch {
+	case statusErr.StatusCode >= 500, statusErr.RateLimited():
+	default:
+		return false, 0
+	}
+	if rl := statusErr.RateLimit; rl != nil {
+		if rl.RetryAfter > 0 {
+			return true, rl.RetryAfter
+		}
+		if statusErr.RateLimited() && !rl.Reset.IsZero() {
+			return true, time.Until(rl.Reset)
+		}
+	}
+	return true, 0
+}
+
+// Fetcher downloads upstream metadata with retries. The zero value makes a
+// single anonymous attempt with http.DefaultClient.
+type Fetcher struct {
+	Client *http.Client
+	Retry  RetryPolicy
+	Token  TokenSource                      // optional; sent as "Authorization: Bearer"
+	Cache  Cache                            // optional; enables If-None-Match / If-Modified-Since
+	Logf   func(format string, args ...any) // optional; receives one line per attempt
+
+	sleep func(ctx context.Context, d time.Duration) error // overridden in tests
+}
+
+// NewFetcher returns a Fetcher using http.DefaultClient and DefaultRetryPolicy.
+func NewFetcher() *Fetcher {
+	return &Fetcher{Client: http.DefaultClient, Retry: DefaultRetryPolicy}
+}
+
+func (f *Fetcher) logf(format string, args ...any) {
+	if f.Logf != nil {
+		f.Logf(format, args...)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// FetchResult describes a completed fetch.
+type FetchResult struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+	// NotModified is set when upstream answered 304 and Body came from the cache.
+	NotModified bool
+}
+
+// Fetch GETs url and returns the body; see Do.
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	res, err := f.Do(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Do GETs url, retrying transient failures (network errors, 5xx, 429 and
+// rate-limited 403s) according to f.Retry. With a Cache it sends the cached
+// validators and serves the cached body on 304 Not Modified.
+func (f *Fetcher) Do(ctx context.Context, url string) (*FetchResult, error) {
+	attempts := f.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	sleep := f.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	var token string
+	if f.Token != nil {
+		var err error
+		if token, err = f.Token.Token(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var cached *CacheEntry
+	if f.Cache != nil {
+		var err error
+		if cached, err = f.Cache.Get(url); err != nil {
+			f.logf("ignoring unreadable cache entry for %s: %v", url, err)
+			cached = nil
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		f.logf("GET %s (attempt %d/%d, authenticated: %t)", url, attempt, attempts, token != "")
+		res, err := f.fetchOnce(ctx, url, token, cached)
+		if err == nil {
+			f.store(url, res)
+			return res, nil
+		}
+
+		retry, wait := retryDelay(err)
+		if !retry || attempt >= attempts {
+			if attempt > 1 {
+				return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return nil, err
+		}
+		if wait > 0 && f.Retry.MaxDelay > 0 && wait > f.Retry.MaxDelay {
+			return nil, fmt.Errorf("server asked to wait %s, more than the %s retry limit: %w",
+				wait.Round(time.Second), f.Retry.MaxDelay, err)
+		}
+		if backoff := f.Retry.backoff(attempt); backoff > wait {
+			wait = backoff
+		}
+		f.logf("attempt %d/%d failed: %v; retrying in %s", attempt, attempts, err, wait.Round(time.Millisecond))
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// store records a fresh or revalidated response in the cache.
+func (f *Fetcher) store(url string, res *FetchResult) {
+	if f.Cache == nil {
+		return
+	}
+	if res.ETag == "" && res.LastModified == "" {
+		return // nothing to revalidate with next time
+	}
+	entry := &CacheEntry{
+		URL:          url,
+		ETag:         res.ETag,
+		LastModified: res.LastModified,
+		FetchedAt:    res.FetchedAt,
+		Body:         res.Body,
+	}
+	if err := f.Cache.Put(url, entry); err != nil {
+		f.logf("failed to cache %s: %v", url, err)
+	}
+}
+
+func (f *Fetcher) fetchOnce(ctx context.Context, url, token string, cached *CacheEntry) (*FetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", GitHubAcceptHeader)
+	req.Header.Set("X-GitHub-Api-Version", GitHubAPIVersion)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	now := time.Now().UTC()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		f.logf("%s not modified since %s", url, cached.FetchedAt.Format(time.RFC3339))
+		return &FetchResult{
+			Body:         cached.Body,
+			ETag:         cached.ETag,
+			LastModified: cached.LastModified,
+			FetchedAt:    now,
+			NotModified:  true,
+		}, nil
+	}
+
+	body, err := readResponse(url, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &FetchResult{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    now,
+	}, nil
+}
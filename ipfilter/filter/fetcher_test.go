@@ -0,0 +1,142 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// noSleep records requested waits instead of sleeping.
+func noSleep(waits *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+}
+
+func TestFetcherRetriesServerErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	var logged []string
+	f := &Fetcher{
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+		Logf: func(format string, args ...any) {
+			logged = append(logged, format)
+		},
+		sleep: noSleep(&waits),
+	}
+
+	body, err := f.Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(body) != "{}" {
+		t.Errorf("Unexpected body: %s", body)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, but got %d", calls)
+	}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	if len(waits) != len(want) || waits[0] != want[0] || waits[1] != want[1] {
+		t.Errorf("Expected waits %v, but got %v", want, waits)
+	}
+	// One line per attempt plus one per retry decision.
+	if len(logged) != 5 {
+		t.Errorf("Expected 5 log lines, but got %d", len(logged))
+	}
+}
+
+func TestFetcherHonoursRetryAfter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	f := &Fetcher{
+		Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Minute},
+		sleep: noSleep(&waits),
+	}
+
+	if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(waits) != 1 || waits[0] != 7*time.Second {
+		t.Errorf("Expected a single 7s wait, but got %v", waits)
+	}
+}
+
+func TestFetcherGivesUpWhenRetryAfterTooLong(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	f := &Fetcher{
+		Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Minute},
+		sleep: noSleep(&waits),
+	}
+
+	_, err := f.Fetch(context.Background(), srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "more than the 1m0s retry limit") {
+		t.Fatalf("Expected a retry limit error, but got %v", err)
+	}
+	if len(waits) != 0 {
+		t.Errorf("Expected no waits, but got %v", waits)
+	}
+}
+
+func TestFetcherDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	f := &Fetcher{Retry: DefaultRetryPolicy, sleep: noSleep(&waits)}
+
+	_, err := f.Fetch(context.Background(), srv.URL)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected a 404 *StatusError, but got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 attempt, but got %d", calls)
+	}
+}
+
+func TestRetryPolicyBackoffIsCappedAndJittered(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: 0.5}
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := p.backoff(attempt)
+		if d < 0 || d > 7500*time.Millisecond {
+			t.Errorf("backoff(%d) = %s, outside the jittered cap", attempt, d)
+		}
+	}
+}
@@ -44,6 +44,12 @@ func ExtractActionsAndFilterIP4(jsonData []byte) ([]string, error) {
 	return filterIP4Addresses(cidrs), nil
 }
 
+// Identifiers of the generated policy and its deny statement.
+const (
+	PolicyID         = "GitHubActionsDenyPolicy"
+	DenyStatementSid = "DenyNonGitHubActionsIPs"
+)
+
 // Build the json Struct for the policy
 type Policy struct {
 	Version   string      `json:"Version"`
@@ -72,10 +78,10 @@ type NotIpAddress struct {
 func BuildDenyPolicy(ips []string) ([]byte, error) {
 	policy := Policy{
 		Version: "2012-10-17",
-		Id:      "GitHubActionsDenyPolicy",
+		Id:      PolicyID,
 		Statement: []Statement{
 			{
-				Sid:       "DenyNonGitHubActionsIPs",
+				Sid:       DenyStatementSid,
 				Effect:    "Deny",
 				Principal: "*",
 				Action:    "ecr:*",
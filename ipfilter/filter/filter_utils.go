@@ -1,20 +1,170 @@
 package ipfilter
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func FetchURL(githubMetaURL string) ([]byte, error) {
-	resp, err := http.Get(githubMetaURL)
+// MaxBodySize caps how much of an upstream response we are willing to read.
+// The GitHub meta document is a few hundred KB, so anything past this is not it.
+const MaxBodySize = 10 << 20
+
+// RateLimit holds the GitHub rate-limit headers returned with a response.
+type RateLimit struct {
+	Limit      int
+	Remaining  int
+	Reset      time.Time
+	RetryAfter time.Duration
+}
+
+func (r *RateLimit) String() string {
+	var parts []string
+	if r.Limit > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d remaining", r.Remaining, r.Limit))
+	}
+	if !r.Reset.IsZero() {
+		parts = append(parts, "resets at "+r.Reset.UTC().Format(time.RFC3339))
+	}
+	if r.RetryAfter > 0 {
+		parts = append(parts, "retry after "+r.RetryAfter.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseRateLimit reads the X-RateLimit-* and Retry-After headers. It returns
+// nil when the response carries none of them.
+func parseRateLimit(h http.Header) *RateLimit {
+	var rl RateLimit
+	found := false
+	if v, err := strconv.Atoi(h.Get("X-RateLimit-Limit")); err == nil {
+		rl.Limit = v
+		found = true
+	}
+	if v, err := strconv.Atoi(h.Get("X-RateLimit-Remaining")); err == nil {
+		rl.Remaining = v
+		found = true
+	}
+	if v, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(v, 0)
+		found = true
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			rl.RetryAfter = time.Duration(secs) * time.Second
+			found = true
+		} else if at, err := http.ParseTime(v); err == nil {
+			rl.RetryAfter = time.Until(at)
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &rl
+}
+
+// StatusError is returned when the upstream answers with a non-2xx status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Message    string // "message" field of a GitHub JSON error body, if any
+	RateLimit  *RateLimit
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("GET %s: unexpected status %s", e.URL, e.Status)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RateLimit != nil {
+		msg += " (rate limit: " + e.RateLimit.String() + ")"
+	}
+	return msg
+}
+
+// RateLimited reports whether the failure was caused by GitHub's rate limiter.
+func (e *StatusError) RateLimited() bool {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return e.StatusCode == http.StatusForbidden && e.RateLimit != nil &&
+		e.RateLimit.Limit > 0 && e.RateLimit.Remaining == 0
+}
+
+// ContentTypeError is returned when the upstream does not answer with JSON.
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("GET %s: expected a JSON response, got content type %q", e.URL, e.ContentType)
+}
+
+// BodyTooLargeError is returned when the response body exceeds Limit bytes.
+type BodyTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("GET %s: response body exceeds %d bytes", e.URL, e.Limit)
+}
+
+// isJSONContentType accepts application/json and any application/*+json type.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return nil, err
+		return false
+	}
+	return mediaType == "application/json" ||
+		(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// readResponse validates the status and content type of resp and reads at
+// most MaxBodySize bytes of its body.
+func readResponse(url string, resp *http.Response) ([]byte, error) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		statusErr := &StatusError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RateLimit:  parseRateLimit(resp.Header),
+		}
+		// GitHub explains most failures in a small JSON body.
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var ghErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(snippet, &ghErr) == nil {
+			statusErr.Message = ghErr.Message
+		}
+		return nil, statusErr
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !isJSONContentType(ct) {
+		return nil, &ContentTypeError{URL: url, ContentType: ct}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
 	if err != nil {
 		return nil, err
 	}
+	if len(body) > MaxBodySize {
+		return nil, &BodyTooLargeError{URL: url, Limit: MaxBodySize}
+	}
 	return body, nil
 }
+
+// FetchURL makes a single GET request; use a Fetcher for retries.
+func FetchURL(githubMetaURL string) ([]byte, error) {
+	return (&Fetcher{}).Fetch(context.Background(), githubMetaURL)
+}
@@ -0,0 +1,121 @@
+package ipfilter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchURLReturnsBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"actions":["4.148.0.0/16"]}`))
+	}))
+	defer srv.Close()
+
+	body, err := FetchURL(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(body) != `{"actions":["4.148.0.0/16"]}` {
+		t.Errorf("Unexpected body: %s", body)
+	}
+}
+
+func TestFetchURLRateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	_, err := FetchURL(srv.URL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected a *StatusError, but got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, but got %d", statusErr.StatusCode)
+	}
+	if !statusErr.RateLimited() {
+		t.Errorf("Expected the error to report a rate limit")
+	}
+	for _, want := range []string{"API rate limit exceeded", "0/60 remaining", "resets at 2023-11-14T22:13:20Z"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q to contain %q", err.Error(), want)
+		}
+	}
+}
+
+func TestFetchURLRejectsServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_, err := FetchURL(srv.URL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected a *StatusError, but got %v", err)
+	}
+	if statusErr.RateLimited() {
+		t.Errorf("A 500 should not be reported as rate limited")
+	}
+}
+
+func TestFetchURLRejectsNonJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>captive portal</html>"))
+	}))
+	defer srv.Close()
+
+	_, err := FetchURL(srv.URL)
+
+	var ctErr *ContentTypeError
+	if !errors.As(err, &ctErr) {
+		t.Fatalf("Expected a *ContentTypeError, but got %v", err)
+	}
+	if ctErr.ContentType != "text/html" {
+		t.Errorf("Expected content type text/html, but got %q", ctErr.ContentType)
+	}
+}
+
+func TestFetchURLRejectsOversizedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.Repeat(" ", MaxBodySize+1)))
+	}))
+	defer srv.Close()
+
+	_, err := FetchURL(srv.URL)
+
+	var sizeErr *BodyTooLargeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("Expected a *BodyTooLargeError, but got %v", err)
+	}
+}
+
+func TestIsJSONContentType(t *testing.T) {
+	cases := map[string]bool{
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/vnd.github+json":     true,
+		"text/plain; charset=utf-8":       false,
+		"":                                false,
+		"application/octet-stream":        false,
+	}
+	for ct, want := range cases {
+		if got := isJSONContentType(ct); got != want {
+			t.Errorf("isJSONContentType(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
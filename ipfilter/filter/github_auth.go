@@ -0,0 +1,121 @@
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Headers GitHub recommends for every REST API call.
+const (
+	GitHubAcceptHeader = "application/vnd.github+json"
+	GitHubAPIVersion   = "2022-11-28"
+)
+
+// TokenSource supplies the GitHub token sent as a bearer header. An empty
+// token means the request goes out unauthenticated.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a token known up front.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return strings.TrimSpace(string(t)), nil
+}
+
+// EnvToken reads the token from the named environment variable. An unset
+// variable is not an error: the fetch simply stays anonymous.
+type EnvToken string
+
+func (t EnvToken) Token(context.Context) (string, error) {
+	return strings.TrimSpace(os.Getenv(string(t))), nil
+}
+
+// FileToken reads the token from a file, e.g. a mounted Kubernetes or Docker secret.
+type FileToken string
+
+func (t FileToken) Token(context.Context) (string, error) {
+	b, err := os.ReadFile(string(t))
+	if err != nil {
+		return "", fmt.Errorf("reading GitHub token: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("reading GitHub token: %s is empty", string(t))
+	}
+	return token, nil
+}
+
+// SecretGetter is the one AWS Secrets Manager call we need. It is kept this
+// small so the SDK client, the Lambda extension or a test fake can satisfy it.
+type SecretGetter interface {
+	GetSecretString(ctx context.Context, secretID string) (string, error)
+}
+
+// SecretToken reads the token from a Secrets Manager secret.
+type SecretToken struct {
+	Client   SecretGetter
+	SecretID string
+}
+
+func (t SecretToken) Token(ctx context.Context) (string, error) {
+	s, err := t.Client.GetSecretString(ctx, t.SecretID)
+	if err != nil {
+		return "", fmt.Errorf("reading GitHub token from secret %s: %w", t.SecretID, err)
+	}
+	token := strings.TrimSpace(s)
+	if token == "" {
+		return "", fmt.Errorf("reading GitHub token: secret %s is empty", t.SecretID)
+	}
+	return token, nil
+}
+
+// LambdaSecretsExtension is a SecretGetter backed by the AWS Parameters and
+// Secrets Lambda Extension, which serves secrets on localhost and avoids
+// pulling the AWS SDK into the binary.
+type LambdaSecretsExtension struct {
+	Endpoint string // defaults to http://localhost:2773
+	Client   *http.Client
+}
+
+func (e LambdaSecretsExtension) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	endpoint := e.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:2773"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		endpoint+"/secretsmanager/get?secretId="+url.QueryEscape(secretID), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Parameters-Secrets-Token", os.Getenv("AWS_SESSION_TOKEN"))
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("secrets extension returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.SecretString, nil
+}
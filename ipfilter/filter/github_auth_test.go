@@ -0,0 +1,115 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) GetSecretString(_ context.Context, id string) (string, error) {
+	s, ok := f[id]
+	if !ok {
+		return "", errors.New("ResourceNotFoundException")
+	}
+	return s, nil
+}
+
+func TestFetcherSendsGitHubHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	f := &Fetcher{Token: StaticToken("ghp_example\n")}
+	if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got.Get("Authorization") != "Bearer ghp_example" {
+		t.Errorf("Expected bearer token, but got %q", got.Get("Authorization"))
+	}
+	if got.Get("Accept") != GitHubAcceptHeader {
+		t.Errorf("Expected Accept %q, but got %q", GitHubAcceptHeader, got.Get("Accept"))
+	}
+	if got.Get("X-GitHub-Api-Version") != GitHubAPIVersion {
+		t.Errorf("Expected API version %q, but got %q", GitHubAPIVersion, got.Get("X-GitHub-Api-Version"))
+	}
+}
+
+func TestFetcherAnonymousWhenEnvTokenUnset(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("IPFILTER_TEST_TOKEN", "")
+	f := &Fetcher{Token: EnvToken("IPFILTER_TEST_TOKEN")}
+	if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if auth != "" {
+		t.Errorf("Expected no Authorization header, but got %q", auth)
+	}
+}
+
+func TestTokenSources(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("IPFILTER_TEST_TOKEN", " from-env ")
+	if tok, _ := EnvToken("IPFILTER_TEST_TOKEN").Token(ctx); tok != "from-env" {
+		t.Errorf("EnvToken: expected from-env, but got %q", tok)
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("from-file\n"), 0600)
+	if tok, err := FileToken(path).Token(ctx); err != nil || tok != "from-file" {
+		t.Errorf("FileToken: expected from-file, but got %q (%v)", tok, err)
+	}
+	if _, err := FileToken(filepath.Join(t.TempDir(), "missing")).Token(ctx); err == nil {
+		t.Errorf("FileToken: expected an error for a missing file")
+	}
+
+	secrets := fakeSecrets{"ci/github": "from-secret"}
+	if tok, err := (SecretToken{Client: secrets, SecretID: "ci/github"}).Token(ctx); err != nil || tok != "from-secret" {
+		t.Errorf("SecretToken: expected from-secret, but got %q (%v)", tok, err)
+	}
+	if _, err := (SecretToken{Client: secrets, SecretID: "nope"}).Token(ctx); err == nil {
+		t.Errorf("SecretToken: expected an error for an unknown secret")
+	}
+}
+
+func TestLambdaSecretsExtension(t *testing.T) {
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Aws-Parameters-Secrets-Token") != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/secretsmanager/get" || r.URL.Query().Get("secretId") != "ci/github" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"Name":"ci/github","SecretString":"ghs_secret"}`))
+	}))
+	defer srv.Close()
+
+	got, err := LambdaSecretsExtension{Endpoint: srv.URL}.GetSecretString(context.Background(), "ci/github")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "ghs_secret" {
+		t.Errorf("Expected ghs_secret, but got %q", got)
+	}
+}
@@ -0,0 +1,120 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Guardrails stop a truncated or empty upstream list from turning into a
+// policy that locks every runner out of ECR.
+type Guardrails struct {
+	// MinCIDRs is the fewest allowed ranges a policy may contain.
+	// An empty list is always refused, whatever this is set to.
+	MinCIDRs int
+	// MaxDropPercent is the largest tolerated shrinkage, in percent of the
+	// previous policy's range count. Zero disables the check.
+	MaxDropPercent float64
+	// Force turns violations into warnings.
+	Force bool
+}
+
+// DefaultGuardrails are used by the CLI and the Lambda unless overridden.
+var DefaultGuardrails = Guardrails{MinCIDRs: 1, MaxDropPercent: 25}
+
+// GuardrailError lists every guardrail a policy violated.
+type GuardrailError struct {
+	Violations []string
+}
+
+func (e *GuardrailError) Error() string {
+	return "refusing to generate policy: " + strings.Join(e.Violations, "; ") + " (force to override)"
+}
+
+// Check compares the allowed ranges of a new policy with those of the
+// previous one (nil when there is none). It ignores Force; callers decide
+// what a violation means.
+func (g Guardrails) Check(current, previous []string) error {
+	var violations []string
+	switch {
+	case len(current) == 0:
+		violations = append(violations, "the allow list is empty, so the policy would deny every runner")
+	case len(current) < g.MinCIDRs:
+		violations = append(violations, fmt.Sprintf("only %d CIDRs, fewer than the minimum of %d", len(current), g.MinCIDRs))
+	}
+	if g.MaxDropPercent > 0 && len(previous) > 0 && len(current) < len(previous) {
+		drop := float64(len(previous)-len(current)) / float64(len(previous)) * 100
+		if drop > g.MaxDropPercent {
+			violations = append(violations, fmt.Sprintf("CIDR count fell from %d to %d (-%.1f%%), more than the allowed %.1f%%",
+				len(previous), len(current), drop, g.MaxDropPercent))
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &GuardrailError{Violations: violations}
+}
+
+// PolicySourceIPs returns the aws:SourceIp ranges of the deny statement in a
+// policy document. Statement may be a single object or a list, and
+// aws:SourceIp a string or a list, as IAM allows.
+func PolicySourceIPs(policy []byte) ([]string, error) {
+	var doc struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(policy, &doc); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	statements, err := rawStatements(doc.Statement)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range statements {
+		var st struct {
+			Sid       string `json:"Sid"`
+			Condition struct {
+				NotIpAddress map[string]stringOrSlice `json:"NotIpAddress"`
+			} `json:"Condition"`
+		}
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, fmt.Errorf("parsing policy statement: %w", err)
+		}
+		if st.Sid == DenyStatementSid {
+			return st.Condition.NotIpAddress["aws:SourceIp"], nil
+		}
+	}
+	return nil, fmt.Errorf("policy has no %q statement", DenyStatementSid)
+}
+
+// rawStatements normalises an IAM Statement element to a list.
+func rawStatements(statement json.RawMessage) ([]json.RawMessage, error) {
+	trimmed := strings.TrimSpace(string(statement))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, "{") {
+		return []json.RawMessage{statement}, nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(statement, &list); err != nil {
+		return nil, fmt.Errorf("parsing policy statements: %w", err)
+	}
+	return list, nil
+}
+
+// stringOrSlice decodes an IAM value that may be a string or a list of strings.
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*s = []string{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
@@ -0,0 +1,90 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGuardrailsCheck(t *testing.T) {
+	previous := []string{"1.0.0.0/8", "2.0.0.0/8", "3.0.0.0/8", "4.0.0.0/8"}
+	g := Guardrails{MinCIDRs: 2, MaxDropPercent: 25}
+
+	cases := map[string]struct {
+		current []string
+		want    string
+	}{
+		"empty":       {nil, "empty"},
+		"below min":   {[]string{"1.0.0.0/8"}, "fewer than the minimum of 2"},
+		"large drop":  {previous[:2], "-50.0%"},
+		"within drop": {previous[:3], ""},
+		"growth":      {append(previous, "5.0.0.0/8"), ""},
+	}
+	for name, c := range cases {
+		err := g.Check(c.current, previous)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, but got %v", name, c.want, err)
+		}
+	}
+
+	if err := (Guardrails{}).Check(nil, nil); err == nil {
+		t.Errorf("Expected an empty list to be refused even with zero guardrails")
+	}
+}
+
+func TestGenerateEnforcesGuardrails(t *testing.T) {
+	previous, err := BuildDenyPolicy([]string{"1.0.0.0/8", "2.0.0.0/8", "3.0.0.0/8", "4.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []byte(`{"actions": ["1.0.0.0/8"]}`)
+
+	_, err = Generate(context.Background(), Options{Input: input, Previous: previous, Guardrails: DefaultGuardrails})
+	var gerr *GuardrailError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("Expected a GuardrailError, but got %v", err)
+	}
+
+	forced := DefaultGuardrails
+	forced.Force = true
+	res, err := Generate(context.Background(), Options{Input: input, Previous: previous, Guardrails: forced})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Policy == nil || len(res.Warnings) != 1 {
+		t.Errorf("Expected a policy and one warning, but got %d warnings", len(res.Warnings))
+	}
+
+	if _, err := Generate(context.Background(), Options{Input: []byte(`{"actions": []}`)}); err == nil {
+		t.Errorf("Expected an empty allow list to be refused")
+	}
+}
+
+func TestPolicySourceIPsAcceptsIAMShorthand(t *testing.T) {
+	policy := []byte(`{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Sid": "` + DenyStatementSid + `",
+			"Effect": "Deny",
+			"Condition": {"NotIpAddress": {"aws:SourceIp": "4.148.0.0/16"}}
+		}
+	}`)
+	ips, err := PolicySourceIPs(policy)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ips) != 1 || ips[0] != "4.148.0.0/16" {
+		t.Errorf("Expected [4.148.0.0/16], but got %v", ips)
+	}
+
+	if _, err := PolicySourceIPs([]byte(`{"Statement": []}`)); err == nil {
+		t.Errorf("Expected an error for a policy without the deny statement")
+	}
+}
@@ -0,0 +1,213 @@
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectStore is a flat key/value blob store with "/"-separated keys, shaped
+// after S3 so a bucket can back the policy history. Get must return an error
+// wrapping fs.ErrNotExist for a missing key.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns every key starting with prefix, in any order.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// DirStore is an ObjectStore in a local directory; keys become paths below
+// it.
+type DirStore struct {
+	Dir string
+}
+
+// Put writes data atomically, creating directories as needed.
+func (d DirStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Get reads the object stored under key.
+func (d DirStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// List walks the directory for keys under prefix. A missing directory is an
+// empty store.
+func (d DirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == d.Dir {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Dir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (d DirStore) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(d.Dir, filepath.FromSlash(key)), nil
+}
+
+// HistoryRecord describes one generated policy.
+type HistoryRecord struct {
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	MetaURL      string    `json:"meta_url,omitempty"`
+	MetaSHA256   string    `json:"meta_sha256"`
+	Keys         []string  `json:"keys"`
+	CIDRCount    int       `json:"cidr_count"`
+	PolicySHA256 string    `json:"policy_sha256"`
+}
+
+// NewHistoryRecord describes a Result whose Policy was generated.
+func NewHistoryRecord(res *Result, createdAt time.Time) *HistoryRecord {
+	return &HistoryRecord{
+		ID:           NewRunID(),
+		CreatedAt:    createdAt.UTC(),
+		MetaURL:      res.MetaURL,
+		MetaSHA256:   res.MetaSHA256,
+		Keys:         res.Keys,
+		CIDRCount:    len(res.CIDRs),
+		PolicySHA256: PolicySHA256(res.Policy),
+	}
+}
+
+// History is the audit trail of generated policies. Each entry is stored as
+// <id>/record.json plus the policy, byte for byte, as <id>/policy.json.
+type History struct {
+	objects ObjectStore
+}
+
+// NewHistory keeps the history in objects.
+func NewHistory(objects ObjectStore) *History {
+	return &History{objects: objects}
+}
+
+const (
+	historyRecordFile = "record.json"
+	historyPolicyFile = "policy.json"
+)
+
+// Save stores a record and its policy. The policy is written first, so a
+// listed record always has its policy.
+func (h *History) Save(ctx context.Context, rec *HistoryRecord, policy []byte) error {
+	if !runIDPattern.MatchString(rec.ID) {
+		return fmt.Errorf("invalid history ID %q", rec.ID)
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := h.objects.Put(ctx, rec.ID+"/"+historyPolicyFile, policy); err != nil {
+		return fmt.Errorf("saving policy history: %w", err)
+	}
+	if err := h.objects.Put(ctx, rec.ID+"/"+historyRecordFile, data); err != nil {
+		return fmt.Errorf("saving policy history: %w", err)
+	}
+	return nil
+}
+
+// List returns every record, newest first.
+func (h *History) List(ctx context.Context) ([]*HistoryRecord, error) {
+	keys, err := h.objects.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing policy history: %w", err)
+	}
+	var records []*HistoryRecord
+	for _, key := range keys {
+		id, file, ok := strings.Cut(key, "/")
+		if !ok || file != historyRecordFile {
+			continue
+		}
+		rec, err := h.record(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	// IDs only have second resolution; CreatedAt orders runs within a second.
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.After(records[j].CreatedAt)
+		}
+		return records[i].ID > records[j].ID
+	})
+	return records, nil
+}
+
+// Get returns a record and its policy. The ID "latest" selects the newest
+// record.
+func (h *History) Get(ctx context.Context, id string) (*HistoryRecord, []byte, error) {
+	if id == "latest" {
+		records, err := h.List(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil, errors.New("policy history is empty")
+		}
+		id = records[0].ID
+	}
+	if !runIDPattern.MatchString(id) {
+		return nil, nil, fmt.Errorf("invalid history ID %q", id)
+	}
+	rec, err := h.record(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := h.objects.Get(ctx, id+"/"+historyPolicyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading policy %s: %w", id, err)
+	}
+	return rec, policy, nil
+}
+
+func (h *History) record(ctx context.Context, id string) (*HistoryRecord, error) {
+	data, err := h.objects.Get(ctx, id+"/"+historyRecordFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no policy history entry %q", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading policy history %s: %w", id, err)
+	}
+	var rec HistoryRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parsing policy history %s: %w", id, err)
+	}
+	return &rec, nil
+}
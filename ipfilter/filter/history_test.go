@@ -0,0 +1,76 @@
+package ipfilter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistorySaveListShow(t *testing.T) {
+	raw, err := os.ReadFile("../raw-data.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	res, err := Generate(context.Background(), Options{Input: raw})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	history := NewHistory(DirStore{Dir: dir})
+
+	if records, err := history.List(ctx); err != nil || len(records) != 0 {
+		t.Fatalf("Expected an empty history, but got %v / %v", records, err)
+	}
+
+	older := NewHistoryRecord(res, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	older.ID = "20250101T000000Z-aaaaaa"
+	newer := NewHistoryRecord(res, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	newer.ID = "20250201T000000Z-bbbbbb"
+	for _, rec := range []*HistoryRecord{older, newer} {
+		if err := history.Save(ctx, rec, res.Policy); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	records, err := history.List(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[0].ID != newer.ID {
+		t.Fatalf("Expected 2 records newest first, but got %+v", records)
+	}
+	if records[0].CIDRCount != len(res.CIDRs) || records[0].MetaSHA256 != res.MetaSHA256 || len(records[0].Keys) != len(DefaultKeys) {
+		t.Errorf("Record did not capture the result: %+v", records[0])
+	}
+
+	rec, policy, err := history.Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rec.ID != newer.ID || string(policy) != string(res.Policy) || PolicySHA256(policy) != rec.PolicySHA256 {
+		t.Errorf("Expected the newest policy byte for byte, but got %s", rec.ID)
+	}
+
+	if _, _, err := history.Get(ctx, "20240101T000000Z-cccccc"); err == nil {
+		t.Errorf("Expected an error for an unknown ID")
+	}
+	if _, _, err := history.Get(ctx, "../x"); err == nil {
+		t.Errorf("Expected an error for an invalid ID")
+	}
+}
+
+func TestDirStoreRejectsEscapingKeys(t *testing.T) {
+	store := DirStore{Dir: t.TempDir()}
+	for _, key := range []string{"../x", "/abs", "a/../../b", ""} {
+		if err := store.Put(context.Background(), key, []byte("x")); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+	if keys, err := (DirStore{Dir: filepath.Join(t.TempDir(), "missing")}).List(context.Background(), ""); err != nil || len(keys) != 0 {
+		t.Errorf("Expected a missing directory to be empty, but got %v / %v", keys, err)
+	}
+}
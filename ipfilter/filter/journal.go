@@ -0,0 +1,223 @@
+package ipfilter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// StatusRolledBack marks a repository whose previous policy was restored.
+const StatusRolledBack = "rolled-back"
+
+// Journal records each repository's policy before an apply changes it, so
+// the run can be undone. With a directory it is rewritten after every
+// change, so it survives a crash halfway through a batch.
+type Journal struct {
+	RunID        string         `json:"run_id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	Region       string         `json:"region,omitempty"`
+	RegistryID   string         `json:"registry_id,omitempty"`
+	PolicySHA256 string         `json:"policy_sha256,omitempty"`
+	Entries      []JournalEntry `json:"entries"`
+
+	mu  sync.Mutex
+	dir string
+}
+
+// JournalEntry is one repository's state before the run touched it.
+type JournalEntry struct {
+	Repository string `json:"repository"`
+	// HadPolicy is false when the repository had no policy; rolling back
+	// then deletes ours.
+	HadPolicy      bool   `json:"had_policy"`
+	PreviousPolicy string `json:"previous_policy,omitempty"`
+	Applied        bool   `json:"applied"`
+	// Failed means ECR rejected the new policy, so nothing needs undoing.
+	Failed     bool `json:"failed,omitempty"`
+	RolledBack bool `json:"rolled_back"`
+}
+
+var runIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// NewRunID returns a sortable, unique run identifier.
+func NewRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// NewJournal starts a journal for a new run. An empty dir keeps it in
+// memory only, which still allows rolling back within the same process.
+// Nothing is written until the first repository is recorded, so a run that
+// changes nothing leaves no journal behind.
+func NewJournal(dir string) *Journal {
+	return &Journal{RunID: NewRunID(), CreatedAt: time.Now().UTC(), dir: dir}
+}
+
+// LoadJournal reads the journal of an earlier run.
+func LoadJournal(dir, runID string) (*Journal, error) {
+	if !runIDPattern.MatchString(runID) {
+		return nil, fmt.Errorf("invalid run ID %q", runID)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, runID+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	j := &Journal{dir: dir}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("parsing journal %s: %w", runID, err)
+	}
+	return j, nil
+}
+
+// Path returns the journal file, or "" for an in-memory journal.
+func (j *Journal) Path() string {
+	if j.dir == "" {
+		return ""
+	}
+	return filepath.Join(j.dir, j.RunID+".json")
+}
+
+// update applies fn under the lock and persists the result.
+func (j *Journal) update(fn func()) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn()
+	return j.save()
+}
+
+func (j *Journal) entry(repo string) *JournalEntry {
+	for i := range j.Entries {
+		if j.Entries[i].Repository == repo {
+			return &j.Entries[i]
+		}
+	}
+	return nil
+}
+
+// save writes the journal atomically once it has entries; the caller holds
+// the lock or owns j.
+func (j *Journal) save() error {
+	if j.dir == "" || len(j.Entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return fmt.Errorf("creating journal directory: %w", err)
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(j.Path(), data); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data via a synced temporary file in
+// the same directory, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// record stores a repository's state before it is changed.
+func (j *Journal) record(entry JournalEntry) error {
+	return j.update(func() {
+		if e := j.entry(entry.Repository); e != nil {
+			*e = entry
+		} else {
+			j.Entries = append(j.Entries, entry)
+		}
+	})
+}
+
+// markApplied notes whether the new policy reached repo.
+func (j *Journal) markApplied(repo string, applied bool) error {
+	return j.update(func() {
+		if e := j.entry(repo); e != nil {
+			e.Applied, e.Failed = applied, !applied
+		}
+	})
+}
+
+// Rollback restores every journaled repository that has not been rolled
+// back yet: its previous policy is set again, or ours is deleted if it had
+// none. Only repositories where ECR rejected the change are skipped; one
+// whose apply may or may not have landed before a crash is restored, which
+// is harmless. Finished entries are marked, so Rollback can be re-run after
+// a partial failure.
+func Rollback(ctx context.Context, client ECRClient, j *Journal, logf func(string, ...any)) (*ApplyReport, error) {
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	var registryID *string
+	if j.RegistryID != "" {
+		registryID = aws.String(j.RegistryID)
+	}
+
+	report := &ApplyReport{PolicySHA256: j.PolicySHA256}
+	for i := range j.Entries {
+		e := j.Entries[i]
+		if e.RolledBack || e.Failed {
+			continue
+		}
+		res := RepositoryResult{Repository: e.Repository, Status: StatusRolledBack}
+		var err error
+		if e.HadPolicy {
+			_, err = client.SetRepositoryPolicy(ctx, &ecr.SetRepositoryPolicyInput{
+				RepositoryName: aws.String(e.Repository),
+				RegistryId:     registryID,
+				PolicyText:     aws.String(e.PreviousPolicy),
+			})
+			res.PolicySHA256 = PolicySHA256([]byte(e.PreviousPolicy))
+		} else {
+			_, err = client.DeleteRepositoryPolicy(ctx, &ecr.DeleteRepositoryPolicyInput{
+				RepositoryName: aws.String(e.Repository),
+				RegistryId:     registryID,
+			})
+			var notFound *types.RepositoryPolicyNotFoundException
+			if errors.As(err, &notFound) {
+				err = nil
+			}
+		}
+		if err != nil {
+			res.Status, res.Error = StatusFailed, err.Error()
+			logf("Failed to roll back %s: %v", e.Repository, err)
+		} else {
+			logf("Rolled back %s", e.Repository)
+			if err := j.update(func() { j.Entries[i].RolledBack = true }); err != nil {
+				return report, err
+			}
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
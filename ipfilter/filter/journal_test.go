@@ -0,0 +1,120 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPolicyRollsBackOnFailure(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	client := newFakeECR("locked")
+	client.policies["shared"] = crossAccountPolicy
+	client.policies["locked"] = crossAccountPolicy
+
+	dir := t.TempDir()
+	journal := NewJournal(dir)
+	report, err := ApplyPolicy(context.Background(), client, policy, ApplyOptions{
+		Repositories:      []string{"shared", "fresh", "locked"},
+		Journal:           journal,
+		RollbackOnFailure: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !report.RolledBack || report.RunID != journal.RunID {
+		t.Fatalf("Expected a rolled back, journaled run, but got %+v", report)
+	}
+	want := map[string]string{"shared": StatusRolledBack, "fresh": StatusRolledBack, "locked": StatusFailed}
+	for _, res := range report.Results {
+		if res.Status != want[res.Repository] {
+			t.Errorf("Expected %s for %s, but got %s", want[res.Repository], res.Repository, res.Status)
+		}
+	}
+	if client.policies["shared"] != crossAccountPolicy {
+		t.Errorf("Expected shared to get its old policy back, but got %s", client.policies["shared"])
+	}
+	if _, ok := client.policies["fresh"]; ok {
+		t.Errorf("Expected our policy to be deleted from fresh, which had none")
+	}
+
+	loaded, err := LoadJournal(dir, journal.RunID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, e := range loaded.Entries {
+		if e.RolledBack == e.Failed {
+			t.Errorf("Expected %s to be either rolled back or failed, but got %+v", e.Repository, e)
+		}
+	}
+}
+
+func TestRollbackFromJournalAfterCrash(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	client := newFakeECR()
+	client.policies["app"] = crossAccountPolicy
+
+	dir := t.TempDir()
+	journal := NewJournal(dir)
+	if _, err := ApplyPolicy(context.Background(), client, policy, ApplyOptions{
+		Repositories: []string{"app"},
+		Journal:      journal,
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.policies["app"] != string(policy) {
+		t.Fatalf("Expected the new policy to be applied")
+	}
+
+	// A later process only has the run ID.
+	loaded, err := LoadJournal(dir, journal.RunID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report, err := Rollback(context.Background(), client, loaded, nil)
+	if err != nil || report.Failed() != 0 {
+		t.Fatalf("Unexpected rollback failure: %v / %v", err, report.Err())
+	}
+	if client.policies["app"] != crossAccountPolicy {
+		t.Errorf("Expected app to get its old policy back, but got %s", client.policies["app"])
+	}
+
+	again, _ := Rollback(context.Background(), client, loaded, nil)
+	if len(again.Results) != 0 {
+		t.Errorf("Expected a second rollback to be a no-op, but got %+v", again.Results)
+	}
+	if _, err := LoadJournal(dir, "../etc/passwd"); err == nil {
+		t.Errorf("Expected an invalid run ID to be rejected")
+	}
+}
+
+func TestJournalOnlyWrittenOnChange(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	dir := filepath.Join(t.TempDir(), "journal")
+
+	_, err := ApplyPolicy(context.Background(), newFakeECR(), policy, ApplyOptions{
+		Repositories: []string{"app"},
+		Journal:      NewJournal(dir),
+		Guardrails:   Guardrails{MinCIDRs: 5},
+	})
+	if err == nil {
+		t.Fatalf("Expected the policy to be refused")
+	}
+	report, err := ApplyPolicy(context.Background(), newFakeECR(), policy, ApplyOptions{
+		Repositories: []string{"app"},
+		Journal:      NewJournal(dir),
+		DryRun:       true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.RunID != "" {
+		t.Errorf("Expected no run ID for a dry run, but got %s", report.RunID)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected no journal directory, but got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package ipfilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Outcomes of MergePolicy for the deny statement.
+const (
+	StatementReplaced = "replaced"
+	StatementInserted = "inserted"
+)
+
+// MergePolicy puts the deny statement of generated into an existing
+// repository policy. A statement with the same Sid is replaced, otherwise
+// the statement is appended; every other statement and top-level element is
+// kept as it was, in its original order. The result is compact JSON.
+//
+// An existing document that cannot be parsed is an error: guessing would
+// risk dropping someone's cross-account access.
+func MergePolicy(existing, generated []byte) (merged []byte, outcome string, err error) {
+	deny, err := denyStatement(generated)
+	if err != nil {
+		return nil, "", err
+	}
+
+	kvs, err := orderedObject(existing)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing existing policy: %w", err)
+	}
+	idx := -1
+	for i, kv := range kvs {
+		if kv.Key == "Statement" {
+			idx = i
+		}
+	}
+	var statements []json.RawMessage
+	if idx >= 0 {
+		if statements, err = rawStatements(kvs[idx].Value.(json.RawMessage)); err != nil {
+			return nil, "", fmt.Errorf("parsing existing policy: %w", err)
+		}
+	}
+
+	out := make([]json.RawMessage, 0, len(statements)+1)
+	outcome = StatementInserted
+	for _, st := range statements {
+		var head struct {
+			Sid string `json:"Sid"`
+		}
+		if err := json.Unmarshal(st, &head); err != nil {
+			return nil, "", fmt.Errorf("parsing existing policy statement: %w", err)
+		}
+		if head.Sid != DenyStatementSid {
+			out = append(out, st)
+			continue
+		}
+		// Duplicate Sids are invalid in IAM; keep only our replacement.
+		if outcome != StatementReplaced {
+			out = append(out, deny)
+			outcome = StatementReplaced
+		}
+	}
+	if outcome == StatementInserted {
+		out = append(out, deny)
+	}
+
+	if idx >= 0 {
+		kvs[idx].Value = out
+	} else {
+		kvs = append(kvs, KV{"Statement", out})
+	}
+	merged, err = ReorderJson(kvs, true)
+	if err != nil {
+		return nil, "", err
+	}
+	return merged, outcome, nil
+}
+
+// denyStatement returns our deny statement from a generated policy.
+func denyStatement(policy []byte) (json.RawMessage, error) {
+	var doc struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(policy, &doc); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	statements, err := rawStatements(doc.Statement)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range statements {
+		var head struct {
+			Sid string `json:"Sid"`
+		}
+		if json.Unmarshal(st, &head) == nil && head.Sid == DenyStatementSid {
+			return st, nil
+		}
+	}
+	return nil, errNoDenyStatement
+}
+
+// orderedObject decodes a JSON object into its members in document order,
+// leaving every value as raw JSON.
+func orderedObject(data []byte) ([]KV, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	var kvs []KV
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, KV{key, value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return kvs, nil
+}
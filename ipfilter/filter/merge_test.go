@@ -0,0 +1,103 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const crossAccountPolicy = `{
+  "Version": "2008-10-17",
+  "Statement": [
+    {
+      "Sid": "AllowCrossAccountPull",
+      "Effect": "Allow",
+      "Principal": {"AWS": ["arn:aws:iam::111122223333:root"]},
+      "Action": ["ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer"],
+      "Condition": {"StringEquals": {"aws:PrincipalOrgID": "o-a1b2c3d4e5"}}
+    }
+  ]
+}`
+
+func TestMergePolicyInsertsAndReplaces(t *testing.T) {
+	first, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	second, _ := BuildDenyPolicy([]string{"13.64.0.0/16"})
+
+	merged, outcome, err := MergePolicy([]byte(crossAccountPolicy), first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if outcome != StatementInserted {
+		t.Errorf("Expected %s, but got %s", StatementInserted, outcome)
+	}
+
+	merged, outcome, err = MergePolicy(merged, second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if outcome != StatementReplaced {
+		t.Errorf("Expected %s, but got %s", StatementReplaced, outcome)
+	}
+
+	var doc struct {
+		Version   string
+		Statement []json.RawMessage
+	}
+	if err := json.Unmarshal(merged, &doc); err != nil {
+		t.Fatalf("Merged policy is not valid JSON: %v", err)
+	}
+	if doc.Version != "2008-10-17" || len(doc.Statement) != 2 {
+		t.Fatalf("Expected the original version and two statements, but got %s", merged)
+	}
+	if !jsonEqual(t, doc.Statement[0], []byte(mustStatement(t, crossAccountPolicy, 0))) {
+		t.Errorf("Cross-account statement changed: %s", doc.Statement[0])
+	}
+	ips, _ := PolicySourceIPs(merged)
+	if len(ips) != 1 || ips[0] != "13.64.0.0/16" {
+		t.Errorf("Expected the deny statement to be replaced, but got %v", ips)
+	}
+}
+
+func TestMergePolicySingleStatementObject(t *testing.T) {
+	existing := `{"Version": "2012-10-17", "Statement": {"Sid": "Other", "Effect": "Allow", "Principal": "*", "Action": "ecr:ListImages"}}`
+	generated, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	merged, _, err := MergePolicy([]byte(existing), generated)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(merged), `"Sid":"Other"`) || !strings.Contains(string(merged), DenyStatementSid) {
+		t.Errorf("Expected both statements, but got %s", merged)
+	}
+}
+
+func TestMergePolicyRefusesUnparseable(t *testing.T) {
+	generated, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	for _, existing := range []string{`not json`, `["a"]`, `{"Statement": "nope"}`, `{"Statement": [1]}`, `{} {}`} {
+		if _, _, err := MergePolicy([]byte(existing), generated); err == nil {
+			t.Errorf("Expected an error for %s", existing)
+		}
+	}
+}
+
+func mustStatement(t *testing.T, policy string, i int) json.RawMessage {
+	t.Helper()
+	var doc struct{ Statement []json.RawMessage }
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Statement[i]
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
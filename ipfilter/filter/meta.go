@@ -0,0 +1,173 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// DefaultMetaURL is the public github.com meta endpoint.
+const DefaultMetaURL = "https://api.github.com/meta"
+
+// DefaultKeys selects the GitHub-hosted Actions runner ranges.
+var DefaultKeys = []string{"actions"}
+
+// MetaURL returns the meta endpoint for a GitHub base URL. An empty base or
+// github.com gives DefaultMetaURL; anything else is treated as GitHub
+// Enterprise Server, whose REST API lives under /api/v3.
+func MetaURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		return DefaultMetaURL, nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid GitHub base URL %q: %w", baseURL, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", fmt.Errorf("invalid GitHub base URL %q: expected http(s)://host", baseURL)
+	}
+	if host := strings.ToLower(u.Hostname()); host == "github.com" || host == "api.github.com" {
+		return DefaultMetaURL, nil
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/meta"):
+	case strings.HasSuffix(path, "/api/v3"):
+		path += "/meta"
+	default:
+		path += "/api/v3/meta"
+	}
+	u.Path = path
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// Meta is the part of a GitHub (or GitHub Enterprise Server) meta document
+// that lists IP ranges.
+type Meta struct {
+	// InstalledVersion is only reported by GitHub Enterprise Server.
+	InstalledVersion string
+	// Ranges maps every top-level key holding addresses (actions, hooks,
+	// git, ...) to its CIDRs, in document order.
+	Ranges map[string][]string
+}
+
+// Enterprise reports whether the document came from GitHub Enterprise Server.
+func (m *Meta) Enterprise() bool {
+	return m.InstalledVersion != ""
+}
+
+// ParseMeta reads a meta document. Keys whose values are not lists of
+// addresses (ssh_keys, domains, ...) are ignored. GHES lists some single
+// hosts as bare addresses; those are widened to /32 or /128.
+func ParseMeta(jsonData []byte) (*Meta, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &raw); err != nil {
+		return nil, err
+	}
+
+	m := &Meta{Ranges: make(map[string][]string)}
+	if v, ok := raw["installed_version"]; ok {
+		json.Unmarshal(v, &m.InstalledVersion)
+	}
+	for key, v := range raw {
+		var list []string
+		if json.Unmarshal(v, &list) != nil {
+			continue
+		}
+		ranges := make([]string, 0, len(list))
+		for _, s := range list {
+			if cidr, err := normalizeCIDR(s); err == nil {
+				ranges = append(ranges, cidr)
+			}
+		}
+		if len(ranges) == 0 && len(list) > 0 {
+			continue // a list, but not of addresses
+		}
+		m.Ranges[key] = ranges
+	}
+	return m, nil
+}
+
+// normalizeCIDR accepts a CIDR or a bare address and returns a CIDR.
+func normalizeCIDR(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		if _, err := netip.ParsePrefix(s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+}
+
+// MissingKeyError is returned when a requested key is not in the meta document.
+type MissingKeyError struct {
+	Key              string
+	InstalledVersion string
+}
+
+func (e *MissingKeyError) Error() string {
+	if e.InstalledVersion != "" {
+		return fmt.Sprintf("meta document has no %q ranges: GitHub Enterprise Server %s does not publish them, "+
+			"supply your self-hosted runner egress ranges instead", e.Key, e.InstalledVersion)
+	}
+	return fmt.Sprintf("meta document has no %q ranges", e.Key)
+}
+
+// CIDRs returns the de-duplicated ranges of the given keys, in key order.
+func (m *Meta) CIDRs(keys []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var cidrs []string
+	for _, key := range keys {
+		ranges, ok := m.Ranges[key]
+		if !ok {
+			return nil, &MissingKeyError{Key: key, InstalledVersion: m.InstalledVersion}
+		}
+		for _, cidr := range ranges {
+			if !seen[cidr] {
+				seen[cidr] = true
+				cidrs = append(cidrs, cidr)
+			}
+		}
+	}
+	return cidrs, nil
+}
+
+// ExtractKeysAndFilterIP4 is ExtractActionsAndFilterIP4 for an arbitrary set of meta keys.
+func ExtractKeysAndFilterIP4(jsonData []byte, keys []string) ([]string, error) {
+	meta, err := ParseMeta(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	cidrs, err := meta.CIDRs(keys)
+	if err != nil {
+		return nil, err
+	}
+	return filterIP4Addresses(cidrs), nil
+}
+
+// ParseRunnerCIDRs validates extra allowed ranges such as self-hosted runner
+// egress. The policy is IPv4-only, so IPv6 ranges are rejected rather than
+// silently dropped.
+func ParseRunnerCIDRs(ranges []string) ([]string, error) {
+	out := make([]string, 0, len(ranges))
+	for _, s := range ranges {
+		cidr, err := normalizeCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid runner CIDR %q: %w", s, err)
+		}
+		if len(filterIP4Addresses([]string{cidr})) == 0 {
+			return nil, fmt.Errorf("runner CIDR %q is not IPv4; the generated policy is IPv4-only", s)
+		}
+		out = append(out, cidr)
+	}
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const ghesMeta = `{
+	"verifiable_password_authentication": true,
+	"installed_version": "3.12.4",
+	"ssh_key_fingerprints": {"SHA256_RSA": "abc"},
+	"ssh_keys": ["ssh-rsa AAAA"],
+	"hooks": ["10.20.0.5"],
+	"git": ["10.20.0.5", "10.20.0.6"],
+	"pages": ["10.20.0.7/32"]
+}`
+
+func TestMetaURL(t *testing.T) {
+	cases := map[string]string{
+		"":                                       DefaultMetaURL,
+		"https://github.com":                     DefaultMetaURL,
+		"https://api.github.com/":                DefaultMetaURL,
+		"https://github.example.com":             "https://github.example.com/api/v3/meta",
+		"https://github.example.com/":            "https://github.example.com/api/v3/meta",
+		"https://github.example.com/api/v3":      "https://github.example.com/api/v3/meta",
+		"https://github.example.com/api/v3/meta": "https://github.example.com/api/v3/meta",
+	}
+	for base, want := range cases {
+		got, err := MetaURL(base)
+		if err != nil {
+			t.Errorf("MetaURL(%q): unexpected error: %v", base, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("MetaURL(%q) = %q, want %q", base, got, want)
+		}
+	}
+
+	if _, err := MetaURL("github.example.com"); err == nil {
+		t.Errorf("Expected an error for a base URL without a scheme")
+	}
+}
+
+func TestParseMetaGHES(t *testing.T) {
+	meta, err := ParseMeta([]byte(ghesMeta))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !meta.Enterprise() || meta.InstalledVersion != "3.12.4" {
+		t.Errorf("Expected a GHES 3.12.4 document, but got %q", meta.InstalledVersion)
+	}
+	if _, ok := meta.Ranges["ssh_keys"]; ok {
+		t.Errorf("ssh_keys should not be treated as a range list")
+	}
+
+	got, err := meta.CIDRs([]string{"hooks", "git"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{"10.20.0.5/32", "10.20.0.6/32"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+
+	_, err = meta.CIDRs(DefaultKeys)
+	var missing *MissingKeyError
+	if !errors.As(err, &missing) || missing.Key != "actions" {
+		t.Fatalf("Expected a missing actions key error, but got %v", err)
+	}
+}
+
+func TestParseRunnerCIDRs(t *testing.T) {
+	got, err := ParseRunnerCIDRs([]string{"203.0.113.0/24", "198.51.100.10"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[1] != "198.51.100.10/32" {
+		t.Errorf("Unexpected runner CIDRs: %v", got)
+	}
+	if _, err := ParseRunnerCIDRs([]string{"2001:db8::/32"}); err == nil {
+		t.Errorf("Expected IPv6 runner CIDRs to be rejected")
+	}
+	if _, err := ParseRunnerCIDRs([]string{"not-an-ip"}); err == nil {
+		t.Errorf("Expected invalid runner CIDRs to be rejected")
+	}
+}
+
+func TestGeneratePolicyAgainstGHESWithPrivateCA(t *testing.T) {
+	var path string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(ghesMeta))
+	}))
+	defer srv.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the bundle the self-signed certificate must be rejected.
+	if _, err := GeneratePolicyWithOptions(context.Background(), Options{
+		Fetcher:     &Fetcher{},
+		BaseURL:     srv.URL,
+		RunnerCIDRs: []string{"203.0.113.0/24"},
+	}); err == nil {
+		t.Fatalf("Expected a TLS verification error without the CA bundle")
+	}
+
+	client, err := NewHTTPClient(TransportOptions{CABundle: bundle})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	policy, err := GeneratePolicyWithOptions(context.Background(), Options{
+		Minify:      true,
+		Fetcher:     &Fetcher{Client: client},
+		BaseURL:     srv.URL,
+		RunnerCIDRs: []string{"203.0.113.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != "/api/v3/meta" {
+		t.Errorf("Expected a request to /api/v3/meta, but got %s", path)
+	}
+
+	var doc Policy
+	if err := json.Unmarshal(policy, &doc); err != nil {
+		t.Fatalf("Failed to unmarshal policy JSON: %v", err)
+	}
+	got := doc.Statement[0].Condition.NotIpAddress.SourceIPs
+	if len(got) != 1 || got[0] != "203.0.113.0/24" {
+		t.Errorf("Expected only the runner CIDR, but got %v", got)
+	}
+}
+
+func TestGeneratePolicyGHESWithoutRunnerCIDRs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(ghesMeta))
+	}))
+	defer srv.Close()
+
+	_, err := GeneratePolicyWithOptions(context.Background(), Options{Fetcher: &Fetcher{}, BaseURL: srv.URL})
+	var missing *MissingKeyError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Expected a *MissingKeyError, but got %v", err)
+	}
+}
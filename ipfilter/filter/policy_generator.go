@@ -1,24 +1,158 @@
 package ipfilter
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 )
 
+// Options configures GeneratePolicyWithOptions.
+type Options struct {
+	Minify  bool
+	Fetcher *Fetcher // nil uses NewFetcher()
+
+	// BaseURL selects a GitHub Enterprise Server instance; empty means github.com.
+	BaseURL string
+	// Keys are the meta keys whose ranges are allowed; nil means DefaultKeys.
+	Keys []string
+	// RunnerCIDRs are extra allowed ranges, e.g. self-hosted runner egress.
+	RunnerCIDRs []string
+
+	// Input, when non-nil, is used instead of fetching: a raw meta document
+	// or a Snapshot. No network access happens in that case.
+	Input []byte
+
+	// Guardrails are checked against Previous, the policy currently in use
+	// (nil when there is none), before a new policy is returned.
+	Guardrails Guardrails
+	Previous   []byte
+}
+
+// Result is everything Generate learned while building a policy.
+type Result struct {
+	Policy      []byte
+	CIDRs       []string   // the allowed IPv4 ranges, in policy order
+	Keys        []string   // the meta keys the ranges were taken from
+	Provenance  Provenance // where every meta and runner range came from
+	MetaURL     string     // empty for raw offline input
+	MetaSHA256  string     // see MetaSHA256
+	FetchedAt   time.Time
+	NotModified bool     // upstream answered 304 Not Modified
+	Warnings    []string // guardrail violations overridden by Guardrails.Force
+}
+
 func GeneratePolicy(minify bool) ([]byte, error) {
-	// 1. Fetch GitHub meta
-	rawData, err := FetchURL("https://api.github.com/meta")
+	return GeneratePolicyWithOptions(context.Background(), Options{Minify: minify})
+}
+
+func GeneratePolicyWithOptions(ctx context.Context, opts Options) ([]byte, error) {
+	res, err := Generate(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return res.Policy, nil
+}
+
+// Generate runs the fetch → extract → build → reorder pipeline.
+func Generate(ctx context.Context, opts Options) (*Result, error) {
+	fetcher := opts.Fetcher
+	if fetcher == nil {
+		fetcher = NewFetcher()
+	}
+
+	keys := opts.Keys
+	if keys == nil {
+		keys = DefaultKeys
+	}
+	runners, err := ParseRunnerCIDRs(opts.RunnerCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	metaURL, err := MetaURL(opts.BaseURL)
 	if err != nil {
 		return nil, err
 	}
 
+	// 1. Fetch GitHub meta (or read it from the offline input)
+	var res *Result
+	var body []byte
+	if opts.Input != nil {
+		doc, snap, err := LoadMetaDocument(opts.Input)
+		if err != nil {
+			return nil, err
+		}
+		res = &Result{}
+		if snap != nil {
+			res.MetaURL, res.FetchedAt = snap.URL, snap.FetchedAt
+		}
+		body = doc
+	} else {
+		fetched, err := fetcher.Do(ctx, metaURL)
+		if err != nil {
+			return nil, err
+		}
+		// A 304 only says the document is unchanged, not that a policy built
+		// from it is current, so the cached body is always built again.
+		res = &Result{MetaURL: metaURL, FetchedAt: fetched.FetchedAt, NotModified: fetched.NotModified}
+		body = fetched.Body
+	}
+	if res.MetaSHA256, err = MetaSHA256(body); err != nil {
+		return nil, err
+	}
+
 	// 2. Extract and filter
-	ipfiltered, err := ExtractActionsAndFilterIP4(rawData)
+	meta, err := ParseMeta(body)
 	if err != nil {
 		return nil, err
 	}
+	cidrs, err := meta.CIDRs(keys)
+	var missing *MissingKeyError
+	if errors.As(err, &missing) && meta.Enterprise() && len(runners) > 0 {
+		// GHES has no hosted runners; the self-hosted egress ranges stand in.
+		var present []string
+		for _, key := range keys {
+			if _, ok := meta.Ranges[key]; ok {
+				present = append(present, key)
+			}
+		}
+		cidrs, err = meta.CIDRs(present)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.CIDRs = filterIP4Addresses(append(cidrs, runners...))
+	res.Keys = keys
+	res.Provenance = meta.Provenance()
+	for _, cidr := range runners {
+		res.Provenance.Add(cidr, RunnerSource)
+	}
+
+	// 2b. Refuse catastrophic shrinkage unless forced
+	var previous []string
+	if opts.Previous != nil {
+		if previous, err = PolicySourceIPs(opts.Previous); err != nil {
+			if !opts.Guardrails.Force {
+				return nil, fmt.Errorf("reading previous policy for guardrails: %w", err)
+			}
+			res.Warnings = append(res.Warnings, "previous policy ignored: "+err.Error())
+		}
+	}
+	if err := opts.Guardrails.Check(res.CIDRs, previous); err != nil {
+		if !opts.Guardrails.Force {
+			return nil, err
+		}
+		var violated *GuardrailError
+		if errors.As(err, &violated) {
+			res.Warnings = append(res.Warnings, violated.Violations...)
+		} else {
+			res.Warnings = append(res.Warnings, err.Error())
+		}
+	}
 
 	// 3. Build deny policy
-	policyJSON, err := BuildDenyPolicy(ipfiltered)
+	policyJSON, err := BuildDenyPolicy(res.CIDRs)
 	if err != nil {
 		return nil, err
 	}
@@ -35,10 +169,10 @@ func GeneratePolicy(minify bool) ([]byte, error) {
 		{Key: "Statement", Value: doc.Statement},
 	}
 
-	reordered, err := ReorderJson(kvs, minify)
+	res.Policy, err = ReorderJson(kvs, opts.Minify)
 	if err != nil {
 		return nil, err
 	}
 
-	return reordered, nil
+	return res, nil
 }
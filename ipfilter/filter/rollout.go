@@ -0,0 +1,254 @@
+package ipfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultRolloutConcurrency is how many account/region targets are updated
+// at once when the config does not say.
+const DefaultRolloutConcurrency = 4
+
+// RolloutConfig lists where a policy is rolled out to and which repositories
+// it applies to in each account/region.
+//
+//	{
+//	  "regions": ["eu-west-1", "us-east-1"],
+//	  "accounts": [
+//	    {"name": "prod", "role_arn": "arn:aws:iam::111122223333:role/ipfilter-rollout"},
+//	    {"name": "dev", "role_arn": "arn:aws:iam::444455556666:role/ipfilter-rollout", "regions": ["eu-west-1"]}
+//	  ],
+//	  "tags": {"ci-locked": "true"},
+//	  "merge": true,
+//	  "concurrency": 4
+//	}
+type RolloutConfig struct {
+	// Accounts to roll out to. Without any, the caller's own credentials
+	// are used as a single unnamed account.
+	Accounts []RolloutAccount `json:"accounts"`
+	// Regions used for every account that does not list its own.
+	Regions []string `json:"regions"`
+
+	// Repository selection, as for ApplyPolicy.
+	RepositorySelection
+	Merge bool `json:"merge,omitempty"`
+	// RollbackOnFailure undoes a target's changes when any of its
+	// repositories fails. Each target is rolled back on its own.
+	RollbackOnFailure bool `json:"rollback_on_failure,omitempty"`
+
+	// Concurrency bounds how many targets run at once.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// RolloutAccount is one AWS account, reached by assuming RoleARN.
+type RolloutAccount struct {
+	Name       string   `json:"name,omitempty"`
+	RoleARN    string   `json:"role_arn,omitempty"`
+	ExternalID string   `json:"external_id,omitempty"`
+	Regions    []string `json:"regions,omitempty"`
+}
+
+// Label names the account in logs and reports: its name, else the account
+// ID from the role ARN, else "default".
+func (a RolloutAccount) Label() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if parts := strings.Split(a.RoleARN, ":"); len(parts) > 4 && parts[4] != "" {
+		return parts[4]
+	}
+	return "default"
+}
+
+// ParseRolloutConfig decodes and validates a rollout config.
+func ParseRolloutConfig(data []byte) (*RolloutConfig, error) {
+	var cfg RolloutConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parsing rollout config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks that every account ends up with at least one region and
+// that the repository selection is usable.
+func (c *RolloutConfig) Validate() error {
+	var problems []string
+	for _, t := range c.Targets() {
+		if t.Region == "" {
+			problems = append(problems, fmt.Sprintf("account %s has no regions", t.Account.Label()))
+		}
+	}
+	if c.RepositorySelection.Empty() {
+		problems = append(problems, "no repositories, prefixes, regex or tags configured")
+	}
+	if c.Concurrency < 0 {
+		problems = append(problems, "concurrency must not be negative")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid rollout config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RolloutTarget is one account in one region.
+type RolloutTarget struct {
+	Account RolloutAccount
+	Region  string
+}
+
+// Targets expands the config into account/region pairs, in config order.
+// An account without regions of its own and no global regions yields a
+// target with an empty Region, which Validate reports.
+func (c *RolloutConfig) Targets() []RolloutTarget {
+	accounts := c.Accounts
+	if len(accounts) == 0 {
+		accounts = []RolloutAccount{{}}
+	}
+	var targets []RolloutTarget
+	for _, a := range accounts {
+		regions := a.Regions
+		if len(regions) == 0 {
+			regions = c.Regions
+		}
+		if len(regions) == 0 {
+			targets = append(targets, RolloutTarget{Account: a})
+		}
+		for _, r := range regions {
+			targets = append(targets, RolloutTarget{Account: a, Region: r})
+		}
+	}
+	return targets
+}
+
+// ClientFactory returns an ECR client for a target, typically by assuming
+// the account's role in the target region.
+type ClientFactory func(ctx context.Context, target RolloutTarget) (ECRClient, error)
+
+// TargetReport is the outcome for one account/region.
+type TargetReport struct {
+	Account string             `json:"account"`
+	Region  string             `json:"region"`
+	Error   string             `json:"error,omitempty"`
+	Results []RepositoryResult `json:"results,omitempty"`
+}
+
+// RolloutReport consolidates every target's ApplyReport.
+type RolloutReport struct {
+	PolicySHA256 string         `json:"policy_sha256"`
+	DryRun       bool           `json:"dry_run,omitempty"`
+	Targets      []TargetReport `json:"targets"`
+}
+
+// Err returns an error summarising failed targets and repositories, or nil.
+func (r *RolloutReport) Err() error {
+	var errs []error
+	for _, t := range r.Targets {
+		where := t.Account + "/" + t.Region
+		if t.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", where, t.Error))
+		}
+		for _, res := range t.Results {
+			if res.Status == StatusFailed {
+				errs = append(errs, fmt.Errorf("%s/%s: %s", where, res.Repository, res.Error))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("rollout incomplete: %w", errors.Join(errs...))
+}
+
+// RolloutOptions controls Rollout.
+type RolloutOptions struct {
+	DryRun bool
+	// Guardrails are checked once before any target is touched; see
+	// ApplyOptions.Guardrails.
+	Guardrails Guardrails
+	Logf       func(string, ...any)
+}
+
+// Rollout applies policy to every target of cfg, at most cfg.Concurrency
+// targets at a time. A target that fails (no client, discovery error) is
+// recorded in the report and does not stop the others.
+func Rollout(ctx context.Context, factory ClientFactory, policy []byte, cfg *RolloutConfig, opts RolloutOptions) (*RolloutReport, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := ParsePolicy(policy); err != nil {
+		return nil, err
+	}
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	if err := checkApplyPolicy(policy, opts.Guardrails, logf); err != nil {
+		return nil, err
+	}
+	concurrency := cfg.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultRolloutConcurrency
+	}
+
+	targets := cfg.Targets()
+	report := &RolloutReport{
+		PolicySHA256: PolicySHA256(policy),
+		DryRun:       opts.DryRun,
+		Targets:      make([]TargetReport, len(targets)),
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target RolloutTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("[%s/%s] ", target.Account.Label(), target.Region)
+			tr := TargetReport{Account: target.Account.Label(), Region: target.Region}
+			defer func() { report.Targets[i] = tr }()
+
+			client, err := factory(ctx, target)
+			if err != nil {
+				tr.Error = err.Error()
+				logf("%sError creating ECR client: %v", prefix, err)
+				return
+			}
+			res, err := ApplyPolicy(ctx, client, policy, ApplyOptions{
+				Repositories:      cfg.Repositories,
+				Filter:            cfg.Filter(),
+				DryRun:            opts.DryRun,
+				Merge:             cfg.Merge,
+				RollbackOnFailure: cfg.RollbackOnFailure,
+				Logf:              func(msg string, args ...any) { logf(prefix+msg, args...) },
+				// Checked above, so forced warnings are logged only once.
+				policyChecked: true,
+			})
+			if res != nil {
+				// A failed rollback still reports what was applied.
+				tr.Results = res.Results
+			}
+			switch {
+			case errors.Is(err, ErrNoRepositories):
+				// Selecting by tag or prefix may legitimately match nothing here.
+				logf("%sNo matching repositories", prefix)
+			case err != nil:
+				tr.Error = err.Error()
+				logf("%sError: %v", prefix, err)
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	return report, nil
+}
@@ -0,0 +1,166 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// gaugedECR tracks how many targets call SetRepositoryPolicy at once.
+type gaugedECR struct {
+	*fakeECR
+	active, peak *int32
+}
+
+func (g gaugedECR) SetRepositoryPolicy(ctx context.Context, in *ecr.SetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.SetRepositoryPolicyOutput, error) {
+	n := atomic.AddInt32(g.active, 1)
+	defer atomic.AddInt32(g.active, -1)
+	for {
+		peak := atomic.LoadInt32(g.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(g.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return g.fakeECR.SetRepositoryPolicy(ctx, in, optFns...)
+}
+
+func TestParseRolloutConfig(t *testing.T) {
+	cfg, err := ParseRolloutConfig([]byte(`{
+		"regions": ["eu-west-1", "us-east-1"],
+		"accounts": [
+			{"role_arn": "arn:aws:iam::111122223333:role/ipfilter"},
+			{"name": "dev", "role_arn": "arn:aws:iam::444455556666:role/ipfilter", "regions": ["eu-central-1"]}
+		],
+		"repositories": ["app"]
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, target := range cfg.Targets() {
+		got = append(got, target.Account.Label()+"/"+target.Region)
+	}
+	want := "111122223333/eu-west-1 111122223333/us-east-1 dev/eu-central-1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Expected targets %s, but got %v", want, got)
+	}
+
+	for name, doc := range map[string]string{
+		"no regions":    `{"repositories": ["app"]}`,
+		"no selection":  `{"regions": ["eu-west-1"]}`,
+		"unknown field": `{"regions": ["eu-west-1"], "repositories": ["app"], "region": "x"}`,
+	} {
+		if _, err := ParseRolloutConfig([]byte(doc)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRolloutBoundedConcurrencyAndReport(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	cfg := &RolloutConfig{
+		Accounts: []RolloutAccount{
+			{Name: "prod"}, {Name: "dev"}, {Name: "broken"},
+		},
+		Regions:             []string{"eu-west-1", "us-east-1"},
+		RepositorySelection: RepositorySelection{Repositories: []string{"app"}},
+		Concurrency:         2,
+	}
+
+	var active, peak int32
+	var mu sync.Mutex
+	clients := map[string]*fakeECR{}
+	factory := func(ctx context.Context, target RolloutTarget) (ECRClient, error) {
+		if target.Account.Name == "broken" {
+			return nil, errors.New("AccessDenied: sts:AssumeRole")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		f := newFakeECR()
+		clients[target.Account.Name+"/"+target.Region] = f
+		return gaugedECR{f, &active, &peak}, nil
+	}
+
+	report, err := Rollout(context.Background(), factory, policy, cfg, RolloutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent targets, but got %d", peak)
+	}
+	if len(report.Targets) != 6 {
+		t.Fatalf("Expected 6 targets, but got %d", len(report.Targets))
+	}
+	for _, target := range report.Targets {
+		if target.Account == "broken" {
+			if target.Error == "" {
+				t.Errorf("Expected an error for %s/%s", target.Account, target.Region)
+			}
+			continue
+		}
+		if len(target.Results) != 1 || target.Results[0].PolicySHA256 != report.PolicySHA256 {
+			t.Errorf("Unexpected results for %s/%s: %+v", target.Account, target.Region, target.Results)
+		}
+		if clients[target.Account+"/"+target.Region].policies["app"] != string(policy) {
+			t.Errorf("Expected %s/%s to receive the policy", target.Account, target.Region)
+		}
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "broken/us-east-1") {
+		t.Errorf("Expected the report error to name the broken targets, but got %v", err)
+	}
+}
+
+func TestRolloutTreatsNoMatchesAsSuccess(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	cfg := &RolloutConfig{
+		Regions:             []string{"eu-west-1"},
+		RepositorySelection: RepositorySelection{Tags: map[string]string{"ci-locked": "true"}},
+	}
+	factory := func(ctx context.Context, target RolloutTarget) (ECRClient, error) {
+		return newFakeECR(), nil
+	}
+	report, err := Rollout(context.Background(), factory, policy, cfg, RolloutOptions{})
+	if err != nil || report.Err() != nil {
+		t.Fatalf("Expected no errors, but got %v / %v", err, report.Err())
+	}
+	if report.Targets[0].Account != "default" {
+		t.Errorf("Expected the default account label, but got %q", report.Targets[0].Account)
+	}
+}
+
+func TestRolloutLogsForcedWarningsOnce(t *testing.T) {
+	policy, _ := BuildDenyPolicy([]string{"4.148.0.0/16"})
+	cfg := &RolloutConfig{
+		Regions:             []string{"eu-west-1", "us-east-1"},
+		RepositorySelection: RepositorySelection{Repositories: []string{"app"}},
+	}
+	factory := func(ctx context.Context, target RolloutTarget) (ECRClient, error) {
+		return newFakeECR(), nil
+	}
+	var mu sync.Mutex
+	var warnings int
+	logf := func(msg string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Contains(msg, "WARNING") {
+			warnings++
+		}
+	}
+	report, err := Rollout(context.Background(), factory, policy, cfg, RolloutOptions{
+		Guardrails: Guardrails{MinCIDRs: 5, Force: true},
+		Logf:       logf,
+	})
+	if err != nil || report.Err() != nil {
+		t.Fatalf("Expected no errors, but got %v / %v", err, report.Err())
+	}
+	if warnings != 1 {
+		t.Errorf("Expected the forced warning to be logged once, but got %d", warnings)
+	}
+}
@@ -0,0 +1,80 @@
+package ipfilter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Snapshot is a saved meta document for offline policy generation.
+type Snapshot struct {
+	URL       string          `json:"url"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	SHA256    string          `json:"sha256"`
+	Meta      json.RawMessage `json:"meta"`
+}
+
+// MetaSHA256 hashes the compacted form of a meta document, so the digest
+// survives re-indentation when the document is embedded in a Snapshot.
+func MetaSHA256(body []byte) (string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewSnapshot wraps a fetched meta document with its origin, time and digest.
+func NewSnapshot(url string, body []byte, fetchedAt time.Time) (*Snapshot, error) {
+	sum, err := MetaSHA256(body)
+	if err != nil {
+		return nil, fmt.Errorf("meta document is not valid JSON: %w", err)
+	}
+	return &Snapshot{URL: url, FetchedAt: fetchedAt.UTC(), SHA256: sum, Meta: body}, nil
+}
+
+// Marshal renders the snapshot as indented JSON.
+func (s *Snapshot) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadMetaDocument accepts either a raw meta document (like raw-data.json)
+// or a Snapshot. For a snapshot it verifies the digest and returns the
+// embedded document together with the snapshot; for a raw document the
+// returned snapshot is nil.
+func LoadMetaDocument(data []byte) ([]byte, *Snapshot, error) {
+	var probe struct {
+		SHA256 string          `json:"sha256"`
+		Meta   json.RawMessage `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, nil, fmt.Errorf("input is not a JSON meta document: %w", err)
+	}
+	if probe.SHA256 == "" || probe.Meta == nil {
+		return data, nil, nil
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, nil, err
+	}
+	sum, err := MetaSHA256(snap.Meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sum != snap.SHA256 {
+		return nil, nil, fmt.Errorf("snapshot digest mismatch: recorded %s, computed %s", snap.SHA256, sum)
+	}
+	return snap.Meta, &snap, nil
+}
@@ -0,0 +1,82 @@
+package ipfilter
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateOfflineFromRawDocument(t *testing.T) {
+	raw, err := os.ReadFile("../raw-data.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	// A Fetcher pointing nowhere proves no network access happens.
+	res, err := Generate(context.Background(), Options{
+		Fetcher: &Fetcher{Client: nil, Retry: RetryPolicy{MaxAttempts: 1}},
+		BaseURL: "http://127.0.0.1:1",
+		Input:   raw,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want, _ := ExtractActionsAndFilterIP4(raw)
+	if len(res.CIDRs) != len(want) || len(want) == 0 {
+		t.Fatalf("Expected %d CIDRs, but got %d", len(want), len(res.CIDRs))
+	}
+	if res.MetaURL != "" || res.MetaSHA256 == "" {
+		t.Errorf("Expected no URL and a digest for raw input, but got %q / %q", res.MetaURL, res.MetaSHA256)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	body := []byte(`{"actions": ["4.148.0.0/16", "2a01:111:f403:d91b::/64"], "note": "<&>"}`)
+	fetchedAt := time.Date(2025, 11, 30, 12, 0, 0, 0, time.UTC)
+
+	snap, err := NewSnapshot(DefaultMetaURL, body, fetchedAt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	encoded, err := snap.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	doc, loaded, err := LoadMetaDocument(encoded)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded == nil || loaded.URL != DefaultMetaURL || !loaded.FetchedAt.Equal(fetchedAt) {
+		t.Fatalf("Snapshot metadata did not round-trip: %+v", loaded)
+	}
+	if sum, _ := MetaSHA256(doc); sum != snap.SHA256 {
+		t.Errorf("Expected digest %s, but got %s", snap.SHA256, sum)
+	}
+
+	res, err := Generate(context.Background(), Options{Input: encoded})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res.CIDRs) != 1 || res.CIDRs[0] != "4.148.0.0/16" {
+		t.Errorf("Unexpected CIDRs: %v", res.CIDRs)
+	}
+	if res.MetaURL != DefaultMetaURL || !res.FetchedAt.Equal(fetchedAt) {
+		t.Errorf("Expected the snapshot origin in the result, but got %q at %s", res.MetaURL, res.FetchedAt)
+	}
+}
+
+func TestSnapshotDetectsTampering(t *testing.T) {
+	snap, _ := NewSnapshot(DefaultMetaURL, []byte(`{"actions":["4.148.0.0/16"]}`), time.Now())
+	encoded, _ := snap.Marshal()
+	tampered := bytes.Replace(encoded, []byte("4.148.0.0/16"), []byte("0.0.0.0/0"), 1)
+
+	_, _, err := LoadMetaDocument(tampered)
+	if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("Expected a digest mismatch, but got %v", err)
+	}
+}
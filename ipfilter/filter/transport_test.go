@@ -0,0 +1,142 @@
+package ipfilter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"internal.example.com", ".corp.example", "10.0.0.0/8", "192.168.1.10", "ghe.example.org:443"}
+	cases := map[string]bool{
+		"internal.example.com":     true,
+		"api.internal.example.com": true,
+		"corp.example":             true,
+		"git.corp.example":         true,
+		"10.1.2.3":                 true,
+		"192.168.1.10":             true,
+		"ghe.example.org":          true,
+		"api.github.com":           false,
+		"notinternal.example.com":  false,
+		"192.168.1.11":             false,
+	}
+	for host, want := range cases {
+		if got := bypassProxy(host, noProxy); got != want {
+			t.Errorf("bypassProxy(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if !bypassProxy("api.github.com", []string{"*"}) {
+		t.Errorf("Expected * to bypass every host")
+	}
+}
+
+func TestNewHTTPClientUsesAuthenticatingProxy(t *testing.T) {
+	var gotURL, gotAuth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer proxy.Close()
+
+	proxyURL := "http://builder:s3cret@" + proxy.Listener.Addr().String()
+	client, err := NewHTTPClient(TransportOptions{ProxyURL: proxyURL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := (&Fetcher{Client: client}).Fetch(context.Background(), "http://meta.example.test/meta"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotURL != "http://meta.example.test/meta" {
+		t.Errorf("Expected the proxy to receive the absolute URL, but got %q", gotURL)
+	}
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("builder:s3cret"))
+	if gotAuth != wantAuth {
+		t.Errorf("Expected Proxy-Authorization %q, but got %q", wantAuth, gotAuth)
+	}
+}
+
+func TestNewHTTPClientRejectsBadOptions(t *testing.T) {
+	for name, opts := range map[string]TransportOptions{
+		"proxy scheme":     {ProxyURL: "ftp://proxy:21"},
+		"proxy host":       {ProxyURL: "http://"},
+		"cert without key": {ClientCert: "client.pem"},
+		"missing bundle":   {CABundle: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := NewHTTPClient(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// writeSelfSignedCert writes a throwaway client certificate and key as PEM.
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ipfilter-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestNewHTTPClientPresentsClientCertificate(t *testing.T) {
+	var subject string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	client, err := NewHTTPClient(TransportOptions{CABundle: bundle, ClientCert: certFile, ClientKey: keyFile})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := (&Fetcher{Client: client}).Fetch(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if subject != "ipfilter-test-client" {
+		t.Errorf("Expected the server to see our client certificate, but got %q", subject)
+	}
+}
@@ -0,0 +1,49 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ValidatePolicy checks that data is a deny policy as this tool writes it:
+// version 2012-10-17, a Deny statement with DenyStatementSid, and at least
+// one aws:SourceIp range, each a valid IPv4 CIDR. It returns every problem
+// found, or nil for a valid policy.
+func ValidatePolicy(data []byte) []string {
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	if p.Version != "2012-10-17" {
+		problems = append(problems, fmt.Sprintf("Version is %q, expected \"2012-10-17\"", p.Version))
+	}
+	st, err := findDenyStatement(p)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	if st.Effect != "Deny" {
+		problems = append(problems, fmt.Sprintf("statement %q has Effect %q, expected \"Deny\"", st.Sid, st.Effect))
+	}
+	if st.Action == "" || st.Principal == "" {
+		problems = append(problems, fmt.Sprintf("statement %q needs a Principal and an Action", st.Sid))
+	}
+	ips := st.Condition.NotIpAddress.SourceIPs
+	if len(ips) == 0 {
+		problems = append(problems, fmt.Sprintf("statement %q allows no aws:SourceIp ranges, which denies everyone", st.Sid))
+	}
+	seen := make(map[string]bool, len(ips))
+	for _, c := range ips {
+		prefix, err := netip.ParsePrefix(c)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("invalid CIDR %q", c))
+		case !prefix.Addr().Is4():
+			problems = append(problems, fmt.Sprintf("CIDR %q is not IPv4", c))
+		case seen[c]:
+			problems = append(problems, fmt.Sprintf("CIDR %q is listed twice", c))
+		}
+		seen[c] = true
+	}
+	return problems
+}
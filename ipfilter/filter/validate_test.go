@@ -0,0 +1,50 @@
+package ipfilter
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	good, _ := BuildDenyPolicy([]string{"4.148.0.0/16", "20.1.2.0/24"})
+	if problems := ValidatePolicy(good); problems != nil {
+		t.Errorf("Expected a generated policy to be valid, but got %v", problems)
+	}
+
+	bad := strings.NewReplacer(
+		`"2012-10-17"`, `"2008-10-17"`,
+		`"Deny"`, `"Allow"`,
+		`"20.1.2.0/24"`, `"20.1.2.0/33", "2001:db8::/32", "4.148.0.0/16"`,
+	).Replace(string(good))
+	problems := ValidatePolicy([]byte(bad))
+	for _, want := range []string{"Version", "Effect", "invalid CIDR", "not IPv4", "listed twice"} {
+		found := false
+		for _, p := range problems {
+			found = found || strings.Contains(p, want)
+		}
+		if !found {
+			t.Errorf("Expected a problem mentioning %q, but got %v", want, problems)
+		}
+	}
+
+	if problems := ValidatePolicy([]byte(`{"Version": "2012-10-17", "Statement": []}`)); len(problems) != 1 {
+		t.Errorf("Expected only the missing statement to be reported, but got %v", problems)
+	}
+	if problems := ValidatePolicy([]byte(`not json`)); len(problems) != 1 {
+		t.Errorf("Expected a parse error, but got %v", problems)
+	}
+}
+
+func TestMatchCIDR(t *testing.T) {
+	cidrs := []string{"4.148.0.0/16", "20.1.2.0/24"}
+	if c, ok := MatchCIDR(cidrs, netip.MustParseAddr("20.1.2.9")); !ok || c != "20.1.2.0/24" {
+		t.Errorf("Expected a match in 20.1.2.0/24, but got %q %v", c, ok)
+	}
+	if c, ok := MatchCIDR(cidrs, netip.MustParseAddr("::ffff:4.148.1.1")); !ok || c != "4.148.0.0/16" {
+		t.Errorf("Expected a 4in6 address to match its IPv4 range, but got %q %v", c, ok)
+	}
+	if _, ok := MatchCIDR(cidrs, netip.MustParseAddr("192.0.2.1")); ok {
+		t.Errorf("Expected 192.0.2.1 not to match")
+	}
+}
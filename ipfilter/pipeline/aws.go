@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	ipfilter "ipfilter/ipfilter/filter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AWSConfig loads credentials and settings the usual way (environment,
+// shared config, instance or Lambda role). An empty region keeps the default.
+func AWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	return config.LoadDefaultConfig(ctx, opts...)
+}
+
+// ECRClientFactory builds an ECR client per rollout target, assuming the
+// account's role with the base credentials when it has one.
+func ECRClientFactory(ctx context.Context, target ipfilter.RolloutTarget) (ipfilter.ECRClient, error) {
+	cfg, err := AWSConfig(ctx, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	if arn := target.Account.RoleARN; arn != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), arn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "ipfilter-rollout"
+			if target.Account.ExternalID != "" {
+				o.ExternalID = aws.String(target.Account.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return ecr.NewFromConfig(cfg), nil
+}
+
+// NewECRClient returns an ECR client for region with the default
+// credentials. It is a variable so commands can be exercised with a fake.
+var NewECRClient = func(ctx context.Context, region string) (ipfilter.ECRClient, error) {
+	cfg, err := AWSConfig(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return ecr.NewFromConfig(cfg), nil
+}
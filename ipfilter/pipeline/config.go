@@ -0,0 +1,209 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv locates the config file when the CLI has no --config, and for
+// the Lambda: a local path or an s3://bucket/key object.
+const ConfigEnv = "IPFILTER_CONFIG"
+
+// EnvPrefix starts the environment variables overriding single settings:
+// the flag name in upper case with underscores, e.g. IPFILTER_MIN_CIDRS=5
+// or IPFILTER_KEYS=actions,hooks. Values are parsed like the flag's.
+const EnvPrefix = "IPFILTER_"
+
+// EnvName returns the environment variable overriding a settings flag.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadConfig reads the config file at location, a local path or
+// s3://bucket/key.
+func LoadConfig(ctx context.Context, location string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return os.ReadFile(location)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid config location %q, expected s3://bucket/key", location)
+	}
+	store, err := NewBucketStore(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, key)
+}
+
+// ResolveSettings returns the settings of a run, from lowest to highest
+// precedence: the defaults, config (YAML, or JSON in the payload schema;
+// nil for none), environment variables found by lookupEnv (see EnvPrefix)
+// and the settings flags set explicitly on fs. lookupEnv and fs may be nil.
+func ResolveSettings(config []byte, lookupEnv func(string) (string, bool), fs *flag.FlagSet) (Settings, error) {
+	s := DefaultSettings()
+	if config != nil {
+		if err := s.applyConfig(config); err != nil {
+			return s, err
+		}
+	}
+
+	// Environment variables and flags are replayed through a flag set bound
+	// to s, so they are parsed the same way.
+	bound := flag.NewFlagSet("settings", flag.ContinueOnError)
+	s.RegisterGenerateFlags(bound)
+	s.RegisterFetchFlags(bound)
+	s.RegisterSelectFlags(bound)
+	s.RegisterRolloutFlags(bound)
+	var errs []error
+	if lookupEnv != nil {
+		bound.VisitAll(func(f *flag.Flag) {
+			if v, ok := lookupEnv(EnvName(f.Name)); ok {
+				if err := bound.Set(f.Name, v); err != nil {
+					errs = append(errs, fmt.Errorf("invalid %s: %w", EnvName(f.Name), err))
+				}
+			}
+		})
+	}
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) {
+			if bound.Lookup(f.Name) != nil {
+				if err := bound.Set(f.Name, f.Value.String()); err != nil {
+					errs = append(errs, fmt.Errorf("invalid --%s: %w", f.Name, err))
+				}
+			}
+		})
+	}
+	return s, errors.Join(errs...)
+}
+
+// ValidateConfig reports every problem in a config file: syntax errors,
+// unknown keys, values of the wrong type and settings that contradict each
+// other. It returns nil for a valid config.
+func ValidateConfig(config []byte) []string {
+	doc, err := decodeConfig(config)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	problems := unknownKeys(doc, reflect.TypeOf(Settings{}), "")
+	// Unknown keys are already reported; decode the rest leniently to find
+	// bad values and conflicts too.
+	s := DefaultSettings()
+	data, err := json.Marshal(doc)
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return append(problems, fmt.Sprintf("config: %v", err))
+	}
+	if _, err := s.RepositoryFilter(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return append(problems, s.Conflicts()...)
+}
+
+// Conflicts lists settings that contradict each other, where one would
+// silently win over the other.
+func (s Settings) Conflicts() []string {
+	var problems []string
+	if s.NoCache && s.CacheDir != "" {
+		problems = append(problems, "no_cache disables the cache_dir cache")
+	}
+	if s.GitHubTokenFile != "" && s.GitHubTokenSecretID != "" {
+		problems = append(problems, "github_token_file and github_token_secret_id both select the GitHub token")
+	}
+	if (s.ClientCert == "") != (s.ClientKey == "") {
+		problems = append(problems, "client_cert and client_key must be set together")
+	}
+	if len(s.NoProxy) > 0 && s.ProxyURL == "" {
+		problems = append(problems, "no_proxy only applies with proxy_url")
+	}
+	return problems
+}
+
+// applyConfig overlays s with a config file. The YAML is converted to JSON,
+// so the file uses the payload schema and its types.
+func (s *Settings) applyConfig(config []byte) error {
+	doc, err := decodeConfig(config)
+	if err != nil {
+		return err
+	}
+	if problems := unknownKeys(doc, reflect.TypeOf(Settings{}), ""); len(problems) > 0 {
+		return fmt.Errorf("config: %s", strings.Join(problems, "; "))
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// decodeConfig parses a YAML document, of which JSON is a subset. An empty
+// document is an empty config.
+func decodeConfig(config []byte) (map[string]any, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(config, &doc); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	return doc, nil
+}
+
+// unknownKeys lists the keys of doc that are not JSON fields of t, looking
+// into nested objects such as retry.
+func unknownKeys(doc map[string]any, t reflect.Type, path string) []string {
+	fields := make(map[string]reflect.Type)
+	jsonFields(t, fields)
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		ft, ok := fields[key]
+		if !ok {
+			problem := fmt.Sprintf("unknown key %q", path+key)
+			if _, ok := fields[strings.ReplaceAll(key, "-", "_")]; ok {
+				problem += fmt.Sprintf(" (did you mean %q?)", path+strings.ReplaceAll(key, "-", "_"))
+			}
+			problems = append(problems, problem)
+			continue
+		}
+		if nested, ok := doc[key].(map[string]any); ok && ft.Kind() == reflect.Struct {
+			problems = append(problems, unknownKeys(nested, ft, path+key+".")...)
+		}
+	}
+	return problems
+}
+
+// jsonFields adds the JSON field names of t to fields, including those of
+// embedded structs such as ipfilter.RepositorySelection.
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			jsonFields(f.Type, fields)
+		case name != "" && name != "-":
+			fields[name] = f.Type
+		}
+	}
+}
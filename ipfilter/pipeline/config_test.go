@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"flag"
+	ipfilter "ipfilter/ipfilter/filter"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveSettingsPrecedence(t *testing.T) {
+	config := []byte(`
+keys: [actions, web]
+min_cidrs: 3
+max_drop_percent: 40
+retry:
+  base_delay: 2s
+`)
+	env := map[string]string{
+		"IPFILTER_MIN_CIDRS":        "5",
+		"IPFILTER_MAX_DROP_PERCENT": "30",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	flagged := DefaultSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagged.RegisterGenerateFlags(fs)
+	flagged.RegisterFetchFlags(fs)
+	if err := fs.Parse([]string{"--min-cidrs", "7"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s, err := ResolveSettings(config, lookupEnv, fs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.MinCIDRs != 7 {
+		t.Errorf("Expected the flag to win over env and file, but got %d", s.MinCIDRs)
+	}
+	if s.MaxDropPercent != 30 {
+		t.Errorf("Expected the env to win over the file, but got %v", s.MaxDropPercent)
+	}
+	if !reflect.DeepEqual(s.Keys, []string{"actions", "web"}) || s.RetryPolicy().BaseDelay != 2*time.Second {
+		t.Errorf("Expected the file to win over the defaults, but got %v and %s", s.Keys, s.RetryPolicy().BaseDelay)
+	}
+	if s.Retry.MaxAttempts != DefaultSettings().Retry.MaxAttempts {
+		t.Errorf("Expected untouched settings to keep their defaults, but got %d", s.Retry.MaxAttempts)
+	}
+
+	env["IPFILTER_MIN_CIDRS"] = "many"
+	if _, err := ResolveSettings(nil, lookupEnv, nil); err == nil {
+		t.Errorf("Expected an invalid environment value to be rejected")
+	}
+	if _, err := ResolveSettings([]byte(`min-cidrs: 3`), nil, nil); err == nil {
+		t.Errorf("Expected an unknown config key to be rejected")
+	}
+}
+
+func TestResolveSelectionSettings(t *testing.T) {
+	config := []byte(`
+repositories: [app, base-images]
+tags: {ci-locked: "true"}
+region: eu-west-1
+registry_id: "123456789012"
+targets: prod-rollout.json
+`)
+	env := map[string]string{
+		"IPFILTER_REPOSITORIES": "api,web",
+		"IPFILTER_REGION":       "us-east-1",
+		"IPFILTER_TARGETS":      "staging-rollout.json",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	flagged := DefaultSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagged.RegisterSelectFlags(fs)
+	if err := fs.Parse([]string{"--region", "ap-south-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s, err := ResolveSettings(config, lookupEnv, fs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(s.Repositories, []string{"api", "web"}) || s.Targets != "staging-rollout.json" {
+		t.Errorf("Expected the env to win over the file, but got %v and %s", s.Repositories, s.Targets)
+	}
+	if s.Region != "ap-south-1" {
+		t.Errorf("Expected the flag to win over env and file, but got %s", s.Region)
+	}
+	filter, err := s.RepositoryFilter()
+	if err != nil || filter.Tags["ci-locked"] != "true" || s.RegistryID != "123456789012" {
+		t.Errorf("Expected the file's tag and registry, but got %v, %s (%v)", filter.Tags, s.RegistryID, err)
+	}
+	if d := DefaultSettings(); d.Targets != "rollout.json" {
+		t.Errorf("Expected the default targets file rollout.json, but got %s", d.Targets)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		want   []string
+	}{
+		{`{"keys": ["actions"], "retry": {"max_attempts": 2}}`, nil},
+		{"", nil},
+		{
+			"min-cidrs: 3\nretry:\n  attempts: 2\nno_proxy: [.corp]\n",
+			[]string{`unknown key "min-cidrs" (did you mean "min_cidrs"?)`, `unknown key "retry.attempts"`, "no_proxy only applies with proxy_url"},
+		},
+		{
+			"repositories: [app]\nprefix: [team-]\ntags: [team=a]\n",
+			[]string{`unknown key "prefix"`, `config: json: cannot unmarshal array into Go struct field Settings.tags of type map[string]string`},
+		},
+		{`{"regex": "team-("}`, []string{"invalid regex: error parsing regexp: missing closing ): `team-(`"}},
+		{
+			"no_cache: true\ncache_dir: /tmp/cache\nclient_cert: cert.pem\n",
+			[]string{"no_cache disables the cache_dir cache", "client_cert and client_key must be set together"},
+		},
+	}
+	for _, tt := range tests {
+		if got := ValidateConfig([]byte(tt.config)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ValidateConfig(%q): Expected %q, but got %q", tt.config, tt.want, got)
+		}
+	}
+	if got := ValidateConfig([]byte("min_cidrs: lots")); len(got) != 1 {
+		t.Errorf("Expected a type error, but got %q", got)
+	}
+}
+
+func TestLoadConfigFromBucket(t *testing.T) {
+	dir := t.TempDir()
+	store := ipfilter.DirStore{Dir: dir}
+	if err := store.Put(context.Background(), "ipfilter/config.yaml", []byte("min_cidrs: 9\n")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	orig := NewBucketStore
+	defer func() { NewBucketStore = orig }()
+	var gotBucket string
+	NewBucketStore = func(ctx context.Context, bucket string) (ipfilter.ObjectStore, error) {
+		gotBucket = bucket
+		return store, nil
+	}
+
+	config, err := LoadConfig(context.Background(), "s3://settings-bucket/ipfilter/config.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotBucket != "settings-bucket" {
+		t.Errorf("Expected bucket settings-bucket, but got %q", gotBucket)
+	}
+	s, err := ResolveSettings(config, nil, nil)
+	if err != nil || s.MinCIDRs != 9 {
+		t.Errorf("Expected min_cidrs 9 from the bucket, but got %d (%v)", s.MinCIDRs, err)
+	}
+	if _, err := LoadConfig(context.Background(), "s3://settings-bucket"); err == nil {
+		t.Errorf("Expected a location without a key to be rejected")
+	}
+}
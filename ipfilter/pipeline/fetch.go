@@ -0,0 +1,77 @@
+// Package pipeline wires the ipfilter library to its environment: the HTTP
+// transport, the GitHub token and the AWS clients. The CLI and the Lambda
+// both build their pipeline through it, from flags or from the payload.
+package pipeline
+
+import (
+	ipfilter "ipfilter/ipfilter/filter"
+	"strings"
+)
+
+// FetchConfig describes how the meta document is fetched.
+type FetchConfig struct {
+	Retry ipfilter.RetryPolicy
+
+	// GitHub token lookup, in order of preference; see TokenSource.
+	TokenFile     string
+	TokenSecretID string
+	TokenEnv      string
+
+	// Proxy and TLS; see ipfilter.TransportOptions.
+	CABundle   string
+	ProxyURL   string
+	NoProxy    []string
+	ClientCert string
+	ClientKey  string
+
+	// Cache keeps the meta document between runs; nil disables it.
+	Cache ipfilter.Cache
+	Logf  func(string, ...any)
+}
+
+// NewFetcher builds an ipfilter.Fetcher from c.
+func NewFetcher(c FetchConfig) (*ipfilter.Fetcher, error) {
+	client, err := ipfilter.NewHTTPClient(ipfilter.TransportOptions{
+		CABundle:   c.CABundle,
+		ProxyURL:   c.ProxyURL,
+		NoProxy:    c.NoProxy,
+		ClientCert: c.ClientCert,
+		ClientKey:  c.ClientKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fetcher := ipfilter.NewFetcher()
+	fetcher.Client = client
+	fetcher.Retry = c.Retry
+	fetcher.Token = TokenSource(c.TokenFile, c.TokenEnv, c.TokenSecretID)
+	fetcher.Logf = c.Logf
+	fetcher.Cache = c.Cache
+	return fetcher, nil
+}
+
+// TokenSource picks where the GitHub token comes from: a file, a Secrets
+// Manager secret or an environment variable, in that order of preference.
+func TokenSource(file, env, secretID string) ipfilter.TokenSource {
+	switch {
+	case file != "":
+		return ipfilter.FileToken(file)
+	case secretID != "":
+		return ipfilter.SecretToken{Client: ipfilter.LambdaSecretsExtension{}, SecretID: secretID}
+	case env != "":
+		return ipfilter.EnvToken(env)
+	}
+	return nil
+}
+
+// SplitList splits a comma-separated value, dropping blanks. An empty value
+// yields an empty, non-nil slice.
+func SplitList(s string) []string {
+	out := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	ipfilter "ipfilter/ipfilter/filter"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitList(t *testing.T) {
+	got := SplitList(" actions, ,web,")
+	if want := []string{"actions", "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+	if got := SplitList(""); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty, non-nil slice, but got %#v", got)
+	}
+}
+
+func TestTokenSourcePreference(t *testing.T) {
+	if _, ok := TokenSource("token.txt", "GITHUB_TOKEN", "secret").(ipfilter.FileToken); !ok {
+		t.Errorf("Expected a file to win over a secret and an env var")
+	}
+	if _, ok := TokenSource("", "GITHUB_TOKEN", "secret").(ipfilter.SecretToken); !ok {
+		t.Errorf("Expected a secret to win over an env var")
+	}
+	if _, ok := TokenSource("", "GITHUB_TOKEN", "").(ipfilter.EnvToken); !ok {
+		t.Errorf("Expected an env var token")
+	}
+	if src := TokenSource("", "", ""); src != nil {
+		t.Errorf("Expected no token source, but got %#v", src)
+	}
+}
+
+func TestNewFetcher(t *testing.T) {
+	retry := ipfilter.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second}
+	cache := ipfilter.NewMemoryCache()
+	fetcher, err := NewFetcher(FetchConfig{Retry: retry, TokenEnv: "GITHUB_TOKEN", Cache: cache})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetcher.Retry != retry || fetcher.Cache != cache || fetcher.Token == nil {
+		t.Errorf("Fetcher did not take the config: %+v", fetcher)
+	}
+	if _, err := NewFetcher(FetchConfig{ProxyURL: "://bad"}); err == nil {
+		t.Errorf("Expected an invalid proxy URL to be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	ipfilter "ipfilter/ipfilter/filter"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3API is the subset of the S3 client used by S3Store.
+type S3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// S3Store is an ipfilter.ObjectStore in an S3 bucket, below an optional key
+// prefix.
+type S3Store struct {
+	Client S3API
+	Bucket string
+	Prefix string
+}
+
+// Put uploads data under key.
+func (s S3Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// Get downloads the object under key. A missing object is an error wrapping
+// fs.ErrNotExist.
+func (s S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+	})
+	var noKey *types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return nil, fmt.Errorf("s3://%s/%s%s: %w", s.Bucket, s.Prefix, key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// List pages through every key under prefix.
+func (s S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	p := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(s.Prefix + prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.ToString(obj.Key), s.Prefix))
+		}
+	}
+	return keys, nil
+}
+
+// NewBucketStore returns the ObjectStore of a bucket with the default
+// credentials. It is a variable so config loading can be exercised with a
+// fake.
+var NewBucketStore = func(ctx context.Context, bucket string) (ipfilter.ObjectStore, error) {
+	cfg, err := AWSConfig(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return S3Store{Client: s3.NewFromConfig(cfg), Bucket: bucket}, nil
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSettingsFlagsAndPayloadAgree(t *testing.T) {
+	fromFlags := DefaultSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fromFlags.RegisterGenerateFlags(fs)
+	fromFlags.RegisterFetchFlags(fs)
+	err := fs.Parse([]string{
+		"--keys", "actions,web", "--runner-cidrs", "203.0.113.0/24", "--minify",
+		"--min-cidrs", "5", "--max-drop-percent", "10",
+		"--github-url", "https://github.example.com", "--no-proxy", ".corp.example",
+		"--max-attempts", "2", "--retry-delay", "250ms",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fromPayload := DefaultSettings()
+	payload := `{"keys": ["actions", "web"], "runner_cidrs": ["203.0.113.0/24"], "minify": true,
+		"min_cidrs": 5, "max_drop_percent": 10,
+		"github_url": "https://github.example.com", "no_proxy": [".corp.example"],
+		"retry": {"max_attempts": 2, "base_delay": "250ms"}}`
+	if err := json.Unmarshal([]byte(payload), &fromPayload); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(fromFlags, fromPayload) {
+		t.Errorf("Expected flags and payload to give the same settings:\n%+v\n%+v", fromFlags, fromPayload)
+	}
+	if fromPayload.Retry.MaxDelay != DefaultSettings().Retry.MaxDelay || fromPayload.GitHubTokenEnv != "GITHUB_TOKEN" {
+		t.Errorf("Expected fields left out to keep their defaults, but got %+v", fromPayload)
+	}
+	if got := fromPayload.RetryPolicy().BaseDelay; got != 250*time.Millisecond {
+		t.Errorf("Expected a 250ms base delay, but got %s", got)
+	}
+}
+
+func TestDurationRejectsNumbers(t *testing.T) {
+	var r RetrySettings
+	if err := json.Unmarshal([]byte(`{"base_delay": 5}`), &r); err == nil {
+		t.Errorf("Expected a bare number to be rejected")
+	}
+	if err := json.Unmarshal([]byte(`{"base_delay": "soon"}`), &r); err == nil {
+		t.Errorf("Expected an invalid duration to be rejected")
+	}
+}